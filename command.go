@@ -4,14 +4,17 @@ import (
 	"bufio"
 	"bytes"
 	_ "embed"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/thesephist/oak/oak"
 )
 
 const PackFileMagicBytes = "oak \x19\x98\x10\x15"
@@ -43,6 +46,106 @@ var cliCommands = map[string]string{
 	"build":   cmdbuild,
 }
 
+// asyncErrorMode is how programs run by the CLI handle errors from
+// asynchronous work, set with the --async-errors flag.
+var asyncErrorMode = oak.AsyncErrorPrint
+
+// virtualClock is whether programs run by the CLI use a virtual clock starting
+// at the current time, set with the --virtual-clock flag.
+var virtualClock = false
+
+// parseFlags consumes interpreter flags given before the file or command from
+// os.Args, so that programs only see their own arguments. It reports whether
+// the flags were valid.
+func parseFlags() bool {
+	const asyncErrorsFlag = "--async-errors"
+	const virtualClockFlag = "--virtual-clock"
+
+	for len(os.Args) > 1 {
+		var modeName string
+		consumed := 2
+		if os.Args[1] == virtualClockFlag {
+			virtualClock = true
+			os.Args = append([]string{os.Args[0]}, os.Args[2:]...)
+			continue
+		} else if os.Args[1] == asyncErrorsFlag {
+			if len(os.Args) < 3 {
+				fmt.Printf("%s requires a value, one of print, exit, or handle\n", asyncErrorsFlag)
+				return false
+			}
+			modeName = os.Args[2]
+			consumed = 3
+		} else if strings.HasPrefix(os.Args[1], asyncErrorsFlag+"=") {
+			modeName = strings.TrimPrefix(os.Args[1], asyncErrorsFlag+"=")
+		} else {
+			break
+		}
+
+		mode, err := oak.ParseAsyncErrorMode(modeName)
+		if err != nil {
+			fmt.Println(err)
+			return false
+		}
+		asyncErrorMode = mode
+		os.Args = append([]string{os.Args[0]}, os.Args[consumed:]...)
+	}
+	return true
+}
+
+func newContextWithCwd() oak.Context {
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println("Could not get working directory")
+		os.Exit(1)
+	}
+	return oak.NewContext(cwd)
+}
+
+// setupContext applies interpreter flags to a new Context and loads builtins.
+func setupContext(ctx *oak.Context) {
+	ctx.SetAsyncErrorMode(asyncErrorMode)
+	if virtualClock {
+		ctx.SetVirtualClock(oak.NewVirtualClock(time.Now()))
+	}
+	ctx.LoadBuiltins()
+}
+
+func mustLoadAllLibs(ctx *oak.Context) {
+	if err := ctx.LoadAllLibs(); err != nil {
+		ctx.ReportError(err)
+		os.Exit(1)
+	}
+}
+
+// exitOnError exits the process if evaluation failed, with the status passed
+// to exit() if the program exited, and after reporting the error as errors
+// from asynchronous work are reported, to stderr, otherwise.
+func exitOnError(ctx *oak.Context, err error) {
+	if err == nil {
+		return
+	}
+
+	var exitErr *oak.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.Code)
+	}
+	ctx.ReportError(err)
+	os.Exit(1)
+}
+
+// waitAndExit waits for the program's asynchronous work to finish, and exits
+// the process with the status passed to exit() if the program exited, or with
+// status 1 if any asynchronous work failed.
+func waitAndExit(ctx *oak.Context) {
+	ctx.Wait()
+	if code, ok := ctx.ExitStatus(); ok {
+		os.Exit(code)
+	}
+	if ctx.AsyncErrors() > 0 {
+		os.Exit(1)
+	}
+}
+
 func isStdinReadable() bool {
 	stdin, _ := os.Stdin.Stat()
 	return (stdin.Mode() & os.ModeCharDevice) == 0
@@ -66,14 +169,12 @@ func performCommandIfExists(command string) bool {
 		return false
 	}
 
-	ctx := NewContextWithCwd()
-	defer ctx.Wait()
-	ctx.LoadBuiltins()
+	ctx := newContextWithCwd()
+	defer waitAndExit(&ctx)
+	setupContext(&ctx)
 
-	if _, err := ctx.Eval(strings.NewReader(commandProgram)); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
+	_, err := ctx.EvalFile(command, strings.NewReader(commandProgram))
+	exitOnError(&ctx, err)
 
 	return true
 }
@@ -128,14 +229,12 @@ func runPackFile() bool {
 		return false
 	}
 
-	ctx := NewContextWithCwd()
-	defer ctx.Wait()
-	ctx.LoadBuiltins()
+	ctx := newContextWithCwd()
+	defer waitAndExit(&ctx)
+	setupContext(&ctx)
 
-	if _, err := ctx.Eval(bytes.NewReader(bundleBytes)); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
+	_, err = ctx.Eval(bytes.NewReader(bundleBytes))
+	exitOnError(&ctx, err)
 
 	return true
 }
@@ -148,25 +247,21 @@ func runFile(filePath string) {
 	}
 	defer file.Close()
 
-	ctx := NewContext(path.Dir(filePath))
-	defer ctx.Wait()
-	ctx.LoadBuiltins()
+	ctx := oak.NewContext(path.Dir(filePath))
+	defer waitAndExit(&ctx)
+	setupContext(&ctx)
 
-	if _, err = ctx.Eval(file); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
+	_, err = ctx.EvalFile(filePath, file)
+	exitOnError(&ctx, err)
 }
 
 func runStdin() {
-	ctx := NewContextWithCwd()
-	defer ctx.Wait()
-	ctx.LoadBuiltins()
+	ctx := newContextWithCwd()
+	defer waitAndExit(&ctx)
+	setupContext(&ctx)
 
-	if _, err := ctx.Eval(os.Stdin); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
+	_, err := ctx.Eval(os.Stdin)
+	exitOnError(&ctx, err)
 }
 
 func runRepl() {
@@ -186,9 +281,9 @@ func runRepl() {
 	}
 	defer rl.Close()
 
-	ctx := NewContextWithCwd()
-	ctx.LoadBuiltins()
-	ctx.mustLoadAllLibs()
+	ctx := newContextWithCwd()
+	setupContext(&ctx)
+	mustLoadAllLibs(&ctx)
 
 	for {
 		line, err := rl.Readline()
@@ -203,38 +298,39 @@ func runRepl() {
 
 		val, err := ctx.Eval(strings.NewReader(line))
 		if err != nil {
-			fmt.Println(err)
+			if _, exited := ctx.ExitStatus(); exited {
+				exitOnError(&ctx, err)
+			}
+			ctx.ReportError(err)
 			continue
 		}
 		fmt.Println(val)
 
 		// keep last evaluated result as __ in REPL
-		ctx.scope.put("__", val)
+		ctx.Set("__", val)
 	}
 }
 
 func runEval() {
-	ctx := NewContextWithCwd()
-	defer ctx.Wait()
-	ctx.LoadBuiltins()
-	ctx.mustLoadAllLibs()
+	ctx := newContextWithCwd()
+	defer waitAndExit(&ctx)
+	setupContext(&ctx)
+	mustLoadAllLibs(&ctx)
 
 	if isStdinReadable() {
 		allInput, _ := io.ReadAll(os.Stdin)
-		allInputValue := StringValue(allInput)
-		ctx.scope.put("stdin", &allInputValue)
+		ctx.Set("stdin", oak.MakeString(string(allInput)))
 	}
 
 	prog := strings.Join(os.Args[2:], " ")
 	if val, err := ctx.Eval(strings.NewReader(prog)); err == nil {
-		if stringVal, ok := val.(*StringValue); ok {
+		if stringVal, ok := val.(*oak.StringValue); ok {
 			fmt.Println(string(*stringVal))
 		} else {
 			fmt.Println(val)
 		}
 	} else {
-		fmt.Println(err)
-		os.Exit(1)
+		exitOnError(&ctx, err)
 	}
 }
 
@@ -243,12 +339,11 @@ func runPipe() {
 		return
 	}
 
-	ctx := NewContextWithCwd()
-	defer ctx.Wait()
-	ctx.LoadBuiltins()
-	ctx.mustLoadAllLibs()
+	ctx := newContextWithCwd()
+	defer waitAndExit(&ctx)
+	setupContext(&ctx)
+	mustLoadAllLibs(&ctx)
 
-	rootScope := ctx.scope
 	stdin := bufio.NewReader(os.Stdin)
 	prog := strings.Join(os.Args[2:], " ")
 	for i := 0; ; i++ {
@@ -261,28 +356,24 @@ func runPipe() {
 		}
 
 		line = bytes.TrimSuffix(line, []byte{'\n'})
-		lineValue := StringValue(line)
 		// each line gets its own top-level subscope to avoid collisions
-		ctx.subScope(&rootScope)
-		ctx.scope.put("line", &lineValue)
-		ctx.scope.put("i", IntValue(i))
+		lineCtx := ctx.SubContext()
+		lineCtx.Set("line", oak.MakeString(string(line)))
+		lineCtx.Set("i", oak.MakeInt(int64(i)))
 
 		// NOTE: currently, the same program is re-tokenized and re-parsed on
 		// every line. This is not efficient, and can be optimized in the
 		// future by parsing once and reusing a single AST.
-		outValue, err := ctx.Eval(strings.NewReader(prog))
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
+		outValue, err := lineCtx.Eval(strings.NewReader(prog))
+		exitOnError(&ctx, err)
 
 		var outLine []byte
 		switch v := outValue.(type) {
-		case NullValue:
+		case oak.NullValue:
 			// lines that return ? are filtered out entirely, which lets Oak's
 			// shorthand `if pattern -> action` notation become very useful
 			continue
-		case *StringValue:
+		case *oak.StringValue:
 			outLine = []byte(*v)
 		default:
 			outLine = []byte(outValue.String())
@@ -0,0 +1,79 @@
+// Package lib embeds the source of the Oak standard library, which Oak
+// programs load by name with import().
+package lib
+
+import (
+	_ "embed"
+)
+
+//go:embed std.oak
+var libstd string
+
+//go:embed str.oak
+var libstr string
+
+//go:embed math.oak
+var libmath string
+
+//go:embed sort.oak
+var libsort string
+
+//go:embed random.oak
+var librandom string
+
+//go:embed fs.oak
+var libfs string
+
+//go:embed fmt.oak
+var libfmt string
+
+//go:embed json.oak
+var libjson string
+
+//go:embed datetime.oak
+var libdatetime string
+
+//go:embed path.oak
+var libpath string
+
+//go:embed http.oak
+var libhttp string
+
+//go:embed test.oak
+var libtest string
+
+//go:embed debug.oak
+var libdebug string
+
+//go:embed cli.oak
+var libcli string
+
+//go:embed md.oak
+var libmd string
+
+//go:embed crypto.oak
+var libcrypto string
+
+//go:embed syntax.oak
+var libsyntax string
+
+// Sources maps the name of each standard library to its Oak source.
+var Sources = map[string]string{
+	"std":      libstd,
+	"str":      libstr,
+	"math":     libmath,
+	"sort":     libsort,
+	"random":   librandom,
+	"fs":       libfs,
+	"fmt":      libfmt,
+	"json":     libjson,
+	"datetime": libdatetime,
+	"path":     libpath,
+	"http":     libhttp,
+	"test":     libtest,
+	"debug":    libdebug,
+	"cli":      libcli,
+	"md":       libmd,
+	"crypto":   libcrypto,
+	"syntax":   libsyntax,
+}
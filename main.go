@@ -7,6 +7,10 @@ func main() {
 		return
 	}
 
+	if !parseFlags() {
+		os.Exit(2)
+	}
+
 	if len(os.Args) > 1 {
 		arg := os.Args[1]
 		if isCommand := performCommandIfExists(arg); !isCommand {
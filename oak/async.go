@@ -0,0 +1,138 @@
+package oak
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// AsyncErrorMode decides what happens when asynchronous work, like a callback
+// passed to a builtin or an HTTP request handler, fails with an error that no
+// Oak code is waiting to receive.
+type AsyncErrorMode int
+
+const (
+	// AsyncErrorPrint reports the error and lets the program carry on. This
+	// is the default.
+	AsyncErrorPrint AsyncErrorMode = iota
+	// AsyncErrorExit reports the first error and then ends the program as if
+	// it had called exit(1).
+	AsyncErrorExit
+	// AsyncErrorHandle calls the Oak function the program passed to
+	// onerror() with an error event for each error, and reports the error
+	// if the program has not set a handler or the handler itself fails.
+	AsyncErrorHandle
+)
+
+var asyncErrorModeNames = map[AsyncErrorMode]string{
+	AsyncErrorPrint:  "print",
+	AsyncErrorExit:   "exit",
+	AsyncErrorHandle: "handle",
+}
+
+func (m AsyncErrorMode) String() string {
+	if name, ok := asyncErrorModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("AsyncErrorMode(%d)", int(m))
+}
+
+// ParseAsyncErrorMode returns the AsyncErrorMode with the given name, which
+// is one of "print", "exit", or "handle".
+func ParseAsyncErrorMode(name string) (AsyncErrorMode, error) {
+	for mode, modeName := range asyncErrorModeNames {
+		if modeName == name {
+			return mode, nil
+		}
+	}
+	return AsyncErrorPrint, fmt.Errorf("unknown async error mode %q, expected print, exit, or handle", name)
+}
+
+// SetAsyncErrorMode sets how errors from asynchronous work are handled in
+// this Context and every Context sharing its engine. It should be called
+// before evaluating any programs.
+func (c *Context) SetAsyncErrorMode(mode AsyncErrorMode) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.asyncErrMode = mode
+}
+
+// AsyncErrors returns the number of errors from asynchronous work in this
+// Context, or any Context sharing its engine, so far, whether or not they
+// were handled by an onerror() handler.
+func (c *Context) AsyncErrors() int {
+	return int(atomic.LoadInt32(&c.eng.asyncErrs))
+}
+
+// asyncError records an error from asynchronous work and handles it according
+// to the engine's AsyncErrorMode. It may be called with or without the
+// interpreter lock held.
+func (e *engine) asyncError(err error) {
+	atomic.AddInt32(&e.asyncErrs, 1)
+
+	if e.asyncErrMode != AsyncErrorExit && errors.Is(err, ErrOutOfFuel) {
+		// no callback, including an onerror() handler, can run without fuel
+		e.reportErr(err)
+		e.end(outOfFuelError())
+		return
+	}
+
+	switch e.asyncErrMode {
+	case AsyncErrorExit:
+		e.reportErr(err)
+		e.exit(1)
+	case AsyncErrorHandle:
+		// the handler is only accessed while holding the interpreter lock,
+		// which the caller may already hold, so it is called like any other
+		// callback from the event loop
+		e.Add(1)
+		go func() {
+			defer e.Done()
+
+			e.Lock()
+			defer e.Unlock()
+			if e.canceled() != nil {
+				return
+			}
+			if e.errHandler == nil {
+				e.reportErr(err)
+				return
+			}
+
+			ctx, handler := e.errHandler.ctx, e.errHandler.fn
+			_, handlerErr := ctx.EvalFnValue(handler, errObj(err.Error()))
+			if handlerErr != nil && e.canceled() == nil {
+				atomic.AddInt32(&e.asyncErrs, 1)
+				e.reportErr(err)
+				e.reportErr(handlerErr)
+			}
+		}()
+	default:
+		e.reportErr(err)
+	}
+}
+
+// asyncErrorHandler is an Oak function set by onerror(), along with the
+// Context in which it was set.
+type asyncErrorHandler struct {
+	ctx *Context
+	fn  Value
+}
+
+func (c *Context) oakOnerror(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("onerror", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch handler := args[0].(type) {
+	case NullValue:
+		c.eng.errHandler = nil
+	case FnValue:
+		c.eng.errHandler = &asyncErrorHandler{ctx: c, fn: handler}
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call onerror(%s)", args[0]),
+		}
+	}
+	return null, nil
+}
@@ -0,0 +1,182 @@
+package oak
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// VirtualClock is a clock for running programs deterministically, usually in
+// tests. In an engine using a virtual clock, time() and nanotime() report the
+// virtual time, and timers do not wait in real time but are queued. Wait runs
+// queued timers one at a time in the order they are due, advancing the
+// virtual time instantly to each, so that callback order is reproducible.
+//
+// A VirtualClock should only be used by one engine.
+type VirtualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    int
+	timers timerQueue
+	// receives a value when a timer is queued, to wake Wait
+	queued chan struct{}
+}
+
+// NewVirtualClock returns a virtual clock reading the given time.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{
+		now:    start,
+		queued: make(chan struct{}, 1),
+	}
+}
+
+// Now returns the current virtual time.
+func (vc *VirtualClock) Now() time.Time {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	return vc.now
+}
+
+// sleep advances the virtual time by d, without running any timers.
+func (vc *VirtualClock) sleep(d time.Duration) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if d > 0 {
+		vc.now = vc.now.Add(d)
+	}
+}
+
+// schedule queues fire to run d from now, and returns a function that
+// removes it from the queue if it has not yet run, reporting whether it did.
+func (vc *VirtualClock) schedule(d time.Duration, fire func()) func() bool {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+
+	t := &virtualTimer{
+		due:  vc.now.Add(d),
+		seq:  vc.seq,
+		fire: fire,
+	}
+	vc.seq++
+	heap.Push(&vc.timers, t)
+
+	select {
+	case vc.queued <- struct{}{}:
+	default:
+	}
+
+	return func() bool {
+		vc.mu.Lock()
+		defer vc.mu.Unlock()
+		if t.index < 0 {
+			return false
+		}
+		heap.Remove(&vc.timers, t.index)
+		return true
+	}
+}
+
+// next removes the timer due soonest from the queue and advances the virtual
+// time to when it is due. It returns nil if no timers are queued.
+func (vc *VirtualClock) next() *virtualTimer {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if len(vc.timers) == 0 {
+		return nil
+	}
+
+	t := heap.Pop(&vc.timers).(*virtualTimer)
+	if t.due.After(vc.now) {
+		vc.now = t.due
+	}
+	return t
+}
+
+type virtualTimer struct {
+	due  time.Time
+	seq  int
+	fire func()
+	// position in the queue, or -1 once removed from it
+	index int
+}
+
+// timerQueue is a heap of timers ordered by when they are due, and then by
+// the order in which they were scheduled.
+type timerQueue []*virtualTimer
+
+func (q timerQueue) Len() int {
+	return len(q)
+}
+
+func (q timerQueue) Less(i, j int) bool {
+	if q[i].due.Equal(q[j].due) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].due.Before(q[j].due)
+}
+
+func (q timerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *timerQueue) Push(x interface{}) {
+	t := x.(*virtualTimer)
+	t.index = len(*q)
+	*q = append(*q, t)
+}
+
+func (q *timerQueue) Pop() interface{} {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*q = old[:len(old)-1]
+	return t
+}
+
+// SetVirtualClock makes this Context, and every Context sharing its engine,
+// use the given virtual clock instead of real time. It should be called
+// before evaluating any programs.
+func (c *Context) SetVirtualClock(vc *VirtualClock) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.clock = vc
+}
+
+// now returns the current time by the engine's clock.
+func (e *engine) now() time.Time {
+	if e.clock != nil {
+		return e.clock.Now()
+	}
+	return time.Now()
+}
+
+// runVirtualTimers runs the engine's queued virtual timers in order until
+// all asynchronous work in the engine, including timers, is done, or the
+// engine ends.
+func (c *Context) runVirtualTimers() {
+	vc := c.eng.clock
+
+	idle := make(chan struct{})
+	go func() {
+		c.eng.Wait()
+		close(idle)
+	}()
+
+	for {
+		if t := vc.next(); t != nil {
+			t.fire()
+			continue
+		}
+
+		select {
+		case <-idle:
+			return
+		case <-c.eng.ended:
+			return
+		case <-vc.queued:
+		}
+	}
+}
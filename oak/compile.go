@@ -0,0 +1,420 @@
+package oak
+
+import (
+	"fmt"
+)
+
+// The compiler lowers a parsed Oak AST into a flat sequence of instructions
+// for a simple stack machine, implemented in vm.go. Each function literal in
+// the program compiles to its own fnProto, and the top level of a program
+// compiles to a fnProto with no fnNode definition.
+
+type opcode byte
+
+const (
+	// push consts[arg]
+	opConst opcode = iota
+	// push a fresh copy of the string constant consts[arg], since Oak
+	// strings are mutable
+	opString
+	opPop
+	opDup
+
+	// variable bindings, where arg is an index into refs for opLoad and
+	// opUpdate, a slot in the current frame for opDefine, and an index into
+	// names for opDefineGlobal
+	opLoad
+	opDefine
+	opDefineGlobal
+	opUpdate
+
+	// composite values
+	opList
+	opObjKey
+	opObject
+	opClosure
+	opGetProp
+	opSetProp
+
+	// operators, where arg is the tokKind of the operator
+	opUnary
+	opBinary
+
+	// control flow, where arg is the target instruction index
+	opJump
+	opJumpIfTrue
+	opJumpIfFalse
+	opMatch
+
+	// function calls, where arg is the number of arguments on the stack
+	opCall
+	opCallSpread
+	opTailCall
+	opTailCallSpread
+	opReturn
+
+	// destructuring assignment
+	opCheckList
+	opCheckObject
+	opIndex
+	opLookup
+
+	// raise a runtime error with the message consts[arg]
+	opError
+)
+
+type instr struct {
+	op  opcode
+	arg int
+}
+
+// fnProto is the compiled form of a single function literal or top-level
+// program. Instruction i was compiled from the AST node src[i], which is used
+// to position and describe runtime errors.
+type fnProto struct {
+	defn   *fnNode
+	code   []instr
+	src    []astNode
+	consts []Value
+	names  []string
+	refs   []varRef
+	protos []*fnProto
+	// number of local variable slots in a call frame for this fnProto
+	slots int
+	// slots for named arguments, or -1 for ignored arguments, and the rest
+	// argument, or -1 if there is none
+	argSlots []int
+	restSlot int
+}
+
+func (p *fnProto) name() string {
+	if p.defn == nil {
+		return ""
+	}
+	return p.defn.name
+}
+
+type compiler struct {
+	proto *fnProto
+	// compiler for the enclosing function literal, if any
+	parent *compiler
+	// innermost lexical scope, or nil at the top level of a program
+	scope *lexScope
+	// indexes into names for deduplicating identifiers
+	nameIndex map[string]int
+}
+
+func newCompiler(defn *fnNode, parent *compiler) *compiler {
+	cmp := &compiler{
+		proto: &fnProto{
+			defn:     defn,
+			restSlot: -1,
+		},
+		parent:    parent,
+		nameIndex: map[string]int{},
+	}
+	if parent != nil {
+		cmp.scope = parent.scope
+	}
+	return cmp
+}
+
+// compileProgram compiles a list of top-level expressions into a fnProto
+// that evaluates to the value of the last expression, or ? if empty.
+func compileProgram(nodes []astNode) *fnProto {
+	cmp := newCompiler(nil, nil)
+	if len(nodes) == 0 {
+		cmp.emitConst(null, nil)
+	}
+	for i, node := range nodes {
+		if i > 0 {
+			cmp.emit(opPop, 0, node)
+		}
+		cmp.compile(node, false)
+	}
+	cmp.emit(opReturn, 0, nil)
+	return cmp.proto
+}
+
+func compileFn(defn *fnNode, parent *compiler) *fnProto {
+	cmp := newCompiler(defn, parent)
+	sc := cmp.pushScope()
+	for _, argName := range defn.args {
+		if argName == "" {
+			cmp.proto.argSlots = append(cmp.proto.argSlots, -1)
+		} else {
+			cmp.proto.argSlots = append(cmp.proto.argSlots, sc.declare(argName))
+		}
+	}
+	if defn.restArg != "" {
+		cmp.proto.restSlot = sc.declare(defn.restArg)
+	}
+	sc.declareAll(defn.body)
+
+	cmp.compile(defn.body, true)
+	cmp.emit(opReturn, 0, defn.body)
+	return cmp.proto
+}
+
+func (cmp *compiler) emit(op opcode, arg int, src astNode) int {
+	cmp.proto.code = append(cmp.proto.code, instr{op: op, arg: arg})
+	cmp.proto.src = append(cmp.proto.src, src)
+	return len(cmp.proto.code) - 1
+}
+
+func (cmp *compiler) emitConst(v Value, src astNode) {
+	cmp.proto.consts = append(cmp.proto.consts, v)
+	cmp.emit(opConst, len(cmp.proto.consts)-1, src)
+}
+
+func (cmp *compiler) emitError(reason string, src astNode) {
+	cmp.proto.consts = append(cmp.proto.consts, MakeString(reason))
+	cmp.emit(opError, len(cmp.proto.consts)-1, src)
+}
+
+func (cmp *compiler) emitLoad(name string, src astNode) {
+	cmp.proto.refs = append(cmp.proto.refs, cmp.resolve(name))
+	cmp.emit(opLoad, len(cmp.proto.refs)-1, src)
+}
+
+func (cmp *compiler) emitUpdate(name string, src astNode) {
+	cmp.proto.refs = append(cmp.proto.refs, cmp.resolve(name))
+	cmp.emit(opUpdate, len(cmp.proto.refs)-1, src)
+}
+
+// emitDefine binds name in the current scope, which is a slot in the current
+// call frame unless this is the top level of a program.
+func (cmp *compiler) emitDefine(name string, src astNode) {
+	if cmp.scope != nil {
+		cmp.emit(opDefine, cmp.scope.declare(name), src)
+		return
+	}
+
+	idx, ok := cmp.nameIndex[name]
+	if !ok {
+		cmp.proto.names = append(cmp.proto.names, name)
+		idx = len(cmp.proto.names) - 1
+		cmp.nameIndex[name] = idx
+	}
+	cmp.emit(opDefineGlobal, idx, src)
+}
+
+// patch points the jump instruction at index jump to the next instruction to
+// be emitted.
+func (cmp *compiler) patch(jump int) {
+	cmp.proto.code[jump].arg = len(cmp.proto.code)
+}
+
+func (cmp *compiler) compileObjKey(node astNode) {
+	if ident, ok := node.(identifierNode); ok {
+		cmp.emitConst(MakeString(ident.payload), node)
+		return
+	}
+	cmp.compile(node, false)
+}
+
+// compile emits instructions that leave the value of node on the stack. If
+// tail is set, node is in tail position of a function body and function calls
+// may reuse the current call frame.
+func (cmp *compiler) compile(node astNode, tail bool) {
+	switch n := node.(type) {
+	case emptyNode:
+		cmp.emitConst(empty, n)
+	case nullNode:
+		cmp.emitConst(null, n)
+	case stringNode:
+		v := StringValue(n.payload)
+		cmp.proto.consts = append(cmp.proto.consts, &v)
+		cmp.emit(opString, len(cmp.proto.consts)-1, n)
+	case intNode:
+		cmp.emitConst(IntValue(n.payload), n)
+	case floatNode:
+		cmp.emitConst(FloatValue(n.payload), n)
+	case boolNode:
+		cmp.emitConst(BoolValue(n.payload), n)
+	case atomNode:
+		cmp.emitConst(AtomValue(n.payload), n)
+	case listNode:
+		for _, elNode := range n.elems {
+			cmp.compile(elNode, false)
+		}
+		cmp.emit(opList, len(n.elems), n)
+	case objectNode:
+		for _, entry := range n.entries {
+			if identKey, ok := entry.key.(identifierNode); ok {
+				cmp.emitConst(MakeString(identKey.payload), entry.key)
+			} else {
+				cmp.compile(entry.key, false)
+				cmp.emit(opObjKey, 0, entry.key)
+			}
+			cmp.compile(entry.val, false)
+		}
+		cmp.emit(opObject, len(n.entries), n)
+	case fnNode:
+		defn := n
+		cmp.proto.protos = append(cmp.proto.protos, compileFn(&defn, cmp))
+		cmp.emit(opClosure, len(cmp.proto.protos)-1, n)
+		if n.name != "" {
+			cmp.emitDefine(n.name, n)
+		}
+	case identifierNode:
+		cmp.emitLoad(n.payload, n)
+	case assignmentNode:
+		cmp.compileAssignment(n)
+	case propertyAccessNode:
+		cmp.compile(n.left, false)
+		cmp.compileObjKey(n.right)
+		cmp.emit(opGetProp, 0, n)
+	case unaryNode:
+		cmp.compile(n.right, false)
+		cmp.emit(opUnary, int(n.op), n)
+	case binaryNode:
+		cmp.compile(n.left, false)
+
+		// short-circuit boolean comparisons
+		shortCircuit := -1
+		switch n.op {
+		case or, plus:
+			shortCircuit = cmp.emit(opJumpIfTrue, 0, n)
+		case and, times:
+			shortCircuit = cmp.emit(opJumpIfFalse, 0, n)
+		}
+
+		cmp.compile(n.right, false)
+		cmp.emit(opBinary, int(n.op), n)
+		if shortCircuit >= 0 {
+			cmp.patch(shortCircuit)
+		}
+	case fnCallNode:
+		cmp.compile(n.fn, false)
+		for _, argNode := range n.args {
+			cmp.compile(argNode, false)
+		}
+
+		var op opcode
+		if n.restArg != nil {
+			cmp.compile(n.restArg, false)
+			if tail {
+				op = opTailCallSpread
+			} else {
+				op = opCallSpread
+			}
+		} else {
+			if tail {
+				op = opTailCall
+			} else {
+				op = opCall
+			}
+		}
+		cmp.emit(op, len(n.args), n)
+	case ifExprNode:
+		cmp.compile(n.cond, false)
+
+		ends := make([]int, len(n.branches))
+		for i, branch := range n.branches {
+			cmp.compile(branch.target, false)
+			match := cmp.emit(opMatch, 0, branch.target)
+			cmp.compile(branch.body, tail)
+			ends[i] = cmp.emit(opJump, 0, branch.body)
+			cmp.patch(match)
+		}
+		cmp.emit(opPop, 0, n)
+		cmp.emitConst(null, n)
+
+		for _, end := range ends {
+			cmp.patch(end)
+		}
+	case blockNode:
+		// empty block returns ? (null)
+		if len(n.exprs) == 0 {
+			cmp.emitConst(null, n)
+			return
+		}
+
+		sc := cmp.pushScope()
+		for _, expr := range n.exprs {
+			sc.declareAll(expr)
+		}
+
+		last := len(n.exprs) - 1
+		for _, expr := range n.exprs[:last] {
+			cmp.compile(expr, false)
+			cmp.emit(opPop, 0, expr)
+		}
+		cmp.compile(n.exprs[last], tail)
+		cmp.popScope()
+	default:
+		panic(fmt.Sprintf("Unexpected astNode type: %s", node))
+	}
+}
+
+func (cmp *compiler) compileBinding(name string, isLocal bool, src astNode) {
+	if isLocal {
+		cmp.emitDefine(name, src)
+	} else {
+		cmp.emitUpdate(name, src)
+	}
+}
+
+func (cmp *compiler) compileAssignment(n assignmentNode) {
+	switch left := n.left.(type) {
+	case identifierNode:
+		cmp.compile(n.right, false)
+		cmp.compileBinding(left.payload, n.isLocal, n)
+	case listNode:
+		cmp.compile(n.right, false)
+		cmp.emit(opCheckList, 0, n)
+
+		for i, mustBeIdent := range left.elems {
+			ident, ok := mustBeIdent.(identifierNode)
+			if !ok {
+				if _, ok = mustBeIdent.(emptyNode); ok {
+					continue
+				}
+
+				cmp.emitError(fmt.Sprintf("element %s in destructured list %s is not an identifier", mustBeIdent, left), n)
+				return
+			}
+
+			cmp.emit(opDup, 0, n)
+			cmp.emit(opIndex, i, n)
+			cmp.compileBinding(ident.payload, n.isLocal, n)
+			cmp.emit(opPop, 0, n)
+		}
+	case objectNode:
+		cmp.compile(n.right, false)
+		cmp.emit(opCheckObject, 0, n)
+
+		for _, entryNode := range left.entries {
+			mustBeIdent := entryNode.val
+			ident, ok := mustBeIdent.(identifierNode)
+			if !ok {
+				// the key is evaluated before the destructured value is
+				// checked, so any side effects still happen
+				cmp.compileObjKey(entryNode.key)
+				cmp.emit(opPop, 0, n)
+
+				if _, ok = mustBeIdent.(emptyNode); ok {
+					continue
+				}
+
+				cmp.emitError(fmt.Sprintf("value %s in destructured object %s is not an identifier", mustBeIdent, left), n)
+				return
+			}
+
+			cmp.emit(opDup, 0, n)
+			cmp.compileObjKey(entryNode.key)
+			cmp.emit(opLookup, 0, n)
+			cmp.compileBinding(ident.payload, n.isLocal, n)
+			cmp.emit(opPop, 0, n)
+		}
+	case propertyAccessNode:
+		cmp.compile(n.right, false)
+		cmp.compile(left.left, false)
+		cmp.compileObjKey(left.right)
+		cmp.emit(opSetProp, 0, n)
+	default:
+		cmp.compile(n.right, false)
+		cmp.emitError(fmt.Sprintf("Invalid assignment target %s", left.String()), n)
+	}
+}
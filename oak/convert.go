@@ -0,0 +1,449 @@
+package oak
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// This file converts between Oak values and ordinary Go values, and binds Go
+// functions of any signature as Oak builtins using those conversions.
+//
+// Go values convert to Oak values as follows:
+//
+//	nil, nil pointers, maps, slices   ?
+//	bool                              bool
+//	int and uint types                int
+//	float types                       float
+//	string, []byte                    string
+//	error                             {type: :error, error: err.Error()}
+//	slices and arrays                 list
+//	maps with string keys             object
+//	structs                           object
+//	functions                         builtin function, see Bind
+//	Value                             itself
+//
+// Struct fields become object keys named by their `oak:"name"` tag, or by
+// their Go name with its leading capitals lowercased. Fields tagged `oak:"-"`
+// and unexported fields are skipped.
+
+var (
+	valueType = reflect.TypeOf((*Value)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// ToValue converts a Go value into an Oak value.
+func ToValue(x interface{}) (Value, error) {
+	if x == nil {
+		return null, nil
+	}
+	return toValue(reflect.ValueOf(x))
+}
+
+func toValue(rv reflect.Value) (Value, error) {
+	if !rv.IsValid() {
+		return null, nil
+	}
+
+	if rv.Type().Implements(valueType) {
+		if (rv.Kind() == reflect.Interface || rv.Kind() == reflect.Ptr) && rv.IsNil() {
+			return null, nil
+		}
+		return rv.Interface().(Value), nil
+	}
+	if rv.Type().Implements(errorType) {
+		if (rv.Kind() == reflect.Interface || rv.Kind() == reflect.Ptr) && rv.IsNil() {
+			return null, nil
+		}
+		return errObj(rv.Interface().(error).Error()), nil
+	}
+	if rv.Type() == bytesType {
+		return MakeString(string(rv.Bytes())), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if rv.IsNil() {
+			return null, nil
+		}
+		return toValue(rv.Elem())
+	case reflect.Bool:
+		return BoolValue(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return IntValue(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return IntValue(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return FloatValue(rv.Float()), nil
+	case reflect.String:
+		return MakeString(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return null, nil
+		}
+		list := make(ListValue, rv.Len())
+		for i := range list {
+			elem, err := toValue(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = elem
+		}
+		return &list, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot convert %s to an Oak value, object keys must be strings", rv.Type())
+		}
+		if rv.IsNil() {
+			return null, nil
+		}
+		obj := ObjectValue{}
+		iter := rv.MapRange()
+		for iter.Next() {
+			val, err := toValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			obj[iter.Key().String()] = val
+		}
+		return obj, nil
+	case reflect.Struct:
+		obj := ObjectValue{}
+		for i, field := range structFields(rv.Type()) {
+			if field.name == "" {
+				continue
+			}
+			val, err := toValue(rv.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			obj[field.name] = val
+		}
+		return obj, nil
+	case reflect.Func:
+		if rv.IsNil() {
+			return null, nil
+		}
+		return Bind("", rv.Interface())
+	}
+
+	return nil, fmt.Errorf("cannot convert %s to an Oak value", rv.Type())
+}
+
+// FromValue converts an Oak value into the Go value target points to. Oak
+// values convert to Go types as ToValue would convert them back, and into an
+// interface{} as ?, bool, int64, float64, string, []interface{}, and
+// map[string]interface{}. Atoms convert to strings, and functions convert only
+// to Value.
+func FromValue(v Value, target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cannot convert an Oak value into non-pointer %T", target)
+	}
+	return fromValue(v, rv.Elem())
+}
+
+func fromValue(v Value, rv reflect.Value) error {
+	if rv.Kind() == reflect.Interface && rv.NumMethod() == 0 {
+		if goVal := goValueOf(v); goVal == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+		} else {
+			rv.Set(reflect.ValueOf(goVal))
+		}
+		return nil
+	}
+	if reflect.TypeOf(v).AssignableTo(rv.Type()) {
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if _, ok := v.(NullValue); ok {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("cannot convert %s to %s", v, rv.Type())
+	}
+
+	if rv.Kind() == reflect.Ptr {
+		elem := reflect.New(rv.Type().Elem())
+		if err := fromValue(v, elem.Elem()); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+	}
+	if rv.Kind() == reflect.Interface {
+		return mismatch()
+	}
+
+	switch val := v.(type) {
+	case BoolValue:
+		if rv.Kind() != reflect.Bool {
+			return mismatch()
+		}
+		rv.SetBool(bool(val))
+	case IntValue:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if rv.OverflowInt(int64(val)) {
+				return fmt.Errorf("%s overflows %s", v, rv.Type())
+			}
+			rv.SetInt(int64(val))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if val < 0 || rv.OverflowUint(uint64(val)) {
+				return fmt.Errorf("%s overflows %s", v, rv.Type())
+			}
+			rv.SetUint(uint64(val))
+		case reflect.Float32, reflect.Float64:
+			rv.SetFloat(float64(val))
+		default:
+			return mismatch()
+		}
+	case FloatValue:
+		if rv.Kind() != reflect.Float32 && rv.Kind() != reflect.Float64 {
+			return mismatch()
+		}
+		rv.SetFloat(float64(val))
+	case *StringValue:
+		switch {
+		case rv.Kind() == reflect.String:
+			rv.SetString(string(*val))
+		case rv.Type() == bytesType:
+			rv.SetBytes(append([]byte{}, *val...))
+		default:
+			return mismatch()
+		}
+	case AtomValue:
+		if rv.Kind() != reflect.String {
+			return mismatch()
+		}
+		rv.SetString(string(val))
+	case *ListValue:
+		switch rv.Kind() {
+		case reflect.Slice:
+			slice := reflect.MakeSlice(rv.Type(), len(*val), len(*val))
+			for i, elem := range *val {
+				if err := fromValue(elem, slice.Index(i)); err != nil {
+					return err
+				}
+			}
+			rv.Set(slice)
+		case reflect.Array:
+			if len(*val) != rv.Len() {
+				return mismatch()
+			}
+			for i, elem := range *val {
+				if err := fromValue(elem, rv.Index(i)); err != nil {
+					return err
+				}
+			}
+		default:
+			return mismatch()
+		}
+	case ObjectValue:
+		switch rv.Kind() {
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return mismatch()
+			}
+			m := reflect.MakeMapWithSize(rv.Type(), len(val))
+			for key, entry := range val {
+				elem := reflect.New(rv.Type().Elem()).Elem()
+				if err := fromValue(entry, elem); err != nil {
+					return err
+				}
+				m.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), elem)
+			}
+			rv.Set(m)
+		case reflect.Struct:
+			for i, field := range structFields(rv.Type()) {
+				if field.name == "" {
+					continue
+				}
+				if entry, ok := val[field.name]; ok {
+					if err := fromValue(entry, rv.Field(i)); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			return mismatch()
+		}
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// goValueOf converts an Oak value into the natural Go representation of it.
+func goValueOf(v Value) interface{} {
+	switch val := v.(type) {
+	case NullValue, EmptyValue:
+		return nil
+	case BoolValue:
+		return bool(val)
+	case IntValue:
+		return int64(val)
+	case FloatValue:
+		return float64(val)
+	case *StringValue:
+		return string(*val)
+	case AtomValue:
+		return string(val)
+	case *ListValue:
+		list := make([]interface{}, len(*val))
+		for i, elem := range *val {
+			list[i] = goValueOf(elem)
+		}
+		return list
+	case ObjectValue:
+		obj := make(map[string]interface{}, len(val))
+		for key, entry := range val {
+			obj[key] = goValueOf(entry)
+		}
+		return obj
+	}
+	return v
+}
+
+type structField struct {
+	// object key for the field, or "" if the field is skipped
+	name string
+}
+
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, t.NumField())
+	for i := range fields {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tag := field.Tag.Get("oak")
+		switch tag {
+		case "-":
+			continue
+		case "":
+			fields[i].name = oakFieldName(field.Name)
+		default:
+			fields[i].name = tag
+		}
+	}
+	return fields
+}
+
+// oakFieldName converts an exported Go name to the camelCase style of Oak
+// object keys, so Name becomes name and URLPath becomes urlPath.
+func oakFieldName(name string) string {
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsUpper(r) {
+			break
+		}
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(r)
+	}
+	return string(runes)
+}
+
+// Bind wraps a Go function of any signature as an Oak builtin function with
+// the given name. Arguments from Oak are converted with FromValue into the
+// function's parameter types, and calls with arguments that cannot be
+// converted fail with a "Mismatched types" error. The function's results are
+// converted with ToValue: none becomes ?, one is returned as is, and more
+// are returned as a list. If the last result is an error, a non-nil error is
+// returned as an error event instead of the other results.
+func Bind(name string, fn interface{}) (BuiltinFnValue, error) {
+	fv := reflect.ValueOf(fn)
+	if fv.Kind() != reflect.Func {
+		return BuiltinFnValue{}, fmt.Errorf("cannot bind %T, not a function", fn)
+	}
+	ft := fv.Type()
+
+	numIn := ft.NumIn()
+	if ft.IsVariadic() {
+		numIn--
+	}
+	numOut := ft.NumOut()
+	returnsErr := numOut > 0 && ft.Out(numOut-1) == errorType
+	if returnsErr {
+		numOut--
+	}
+
+	bound := func(args []Value) (Value, *RuntimeError) {
+		if len(args) < numIn {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("%s requires %d arguments, got %d", name, numIn, len(args)),
+			}
+		}
+		if !ft.IsVariadic() && len(args) > numIn {
+			args = args[:numIn]
+		}
+
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var argType reflect.Type
+			if i < numIn {
+				argType = ft.In(i)
+			} else {
+				argType = ft.In(numIn).Elem()
+			}
+
+			in[i] = reflect.New(argType).Elem()
+			if err := fromValue(arg, in[i]); err != nil {
+				argStrings := make([]string, len(args))
+				for j, arg := range args {
+					argStrings[j] = arg.String()
+				}
+				return nil, &RuntimeError{
+					reason: fmt.Sprintf("Mismatched types in call %s(%s)", name, strings.Join(argStrings, ", ")),
+				}
+			}
+		}
+
+		out := fv.Call(in)
+		if returnsErr && !out[numOut].IsNil() {
+			return errObj(out[numOut].Interface().(error).Error()), nil
+		}
+
+		results := make(ListValue, numOut)
+		for i := range results {
+			result, err := toValue(out[i])
+			if err != nil {
+				return nil, &RuntimeError{
+					reason: fmt.Sprintf("Could not convert result of %s(): %s", name, err.Error()),
+				}
+			}
+			results[i] = result
+		}
+		switch numOut {
+		case 0:
+			return null, nil
+		case 1:
+			return results[0], nil
+		default:
+			return &results, nil
+		}
+	}
+
+	return BuiltinFnValue{
+		name: name,
+		fn:   bound,
+	}, nil
+}
+
+// LoadGoFunc defines a global function with the given name that calls the Go
+// function fn, bound as with Bind.
+func (c *Context) LoadGoFunc(name string, fn interface{}) error {
+	builtin, err := Bind(name, fn)
+	if err != nil {
+		return err
+	}
+	c.scope.put(name, builtin)
+	return nil
+}
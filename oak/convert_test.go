@@ -0,0 +1,149 @@
+package oak
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testUser struct {
+	Name     string
+	UserID   int `oak:"id"`
+	Scores   []float64
+	Admin    bool
+	Password string `oak:"-"`
+	note     string
+}
+
+func TestToValue(t *testing.T) {
+	val, err := ToValue(map[string]interface{}{
+		"user": testUser{
+			Name:     "Linus",
+			UserID:   3,
+			Scores:   []float64{1.5, 2},
+			Password: "hunter2",
+			note:     "unexported",
+		},
+		"tags":  []string{"a", "b"},
+		"bytes": []byte("raw"),
+		"err":   errors.New("failed"),
+		"none":  (*testUser)(nil),
+	})
+	if err != nil {
+		t.Fatalf("Did not expect conversion to fail: %s", err.Error())
+	}
+
+	expected := ObjectValue{
+		"user": ObjectValue{
+			"name":   MakeString("Linus"),
+			"id":     IntValue(3),
+			"scores": MakeList(FloatValue(1.5), FloatValue(2)),
+			"admin":  oakFalse,
+		},
+		"tags":  MakeList(MakeString("a"), MakeString("b")),
+		"bytes": MakeString("raw"),
+		"err":   errObj("failed"),
+		"none":  null,
+	}
+	if !val.Eq(expected) || len(val.(ObjectValue)["user"].(ObjectValue)) != 4 {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+
+	if _, err := ToValue(map[int]string{}); err == nil {
+		t.Errorf("Expected maps without string keys not to convert")
+	}
+}
+
+func TestFromValue(t *testing.T) {
+	var user testUser
+	err := FromValue(ObjectValue{
+		"name":   MakeString("Linus"),
+		"id":     IntValue(3),
+		"scores": MakeList(IntValue(1), FloatValue(2.5)),
+		"admin":  oakTrue,
+	}, &user)
+	if err != nil {
+		t.Fatalf("Did not expect conversion to fail: %s", err.Error())
+	}
+	if user.Name != "Linus" || user.UserID != 3 || !user.Admin ||
+		len(user.Scores) != 2 || user.Scores[1] != 2.5 {
+		t.Errorf("Got unexpected struct %#v", user)
+	}
+
+	var generic interface{}
+	if err := FromValue(MakeList(null, AtomValue("ok"), ObjectValue{"n": IntValue(1)}), &generic); err != nil {
+		t.Fatalf("Did not expect conversion to fail: %s", err.Error())
+	}
+	if fmt.Sprint(generic) != "[<nil> ok map[n:1]]" {
+		t.Errorf("Got unexpected value %#v", generic)
+	}
+
+	var n uint8
+	if err := FromValue(IntValue(300), &n); err == nil {
+		t.Errorf("Expected overflowing conversion to fail")
+	}
+	var s string
+	if err := FromValue(IntValue(1), &s); err == nil {
+		t.Errorf("Expected int not to convert to a string")
+	}
+}
+
+func TestBindGoFunctions(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	ctx.LoadGoFunc("repeat", strings.Repeat)
+	ctx.LoadGoFunc("sum", func(xs ...int) int {
+		total := 0
+		for _, x := range xs {
+			total += x
+		}
+		return total
+	})
+	ctx.LoadGoFunc("divide", func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	})
+	ctx.LoadGoFunc("greet", func(u testUser) string {
+		return "Hello, " + u.Name
+	})
+
+	val, err := ctx.Eval(strings.NewReader(`[
+		repeat('ab', 3)
+		sum()
+		sum(1, 2, 3)
+		divide(1, 4)
+		divide(1, 0)
+		greet({ name: 'Linus' })
+	]`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(
+		MakeString("ababab"),
+		IntValue(0),
+		IntValue(6),
+		FloatValue(0.25),
+		errObj("division by zero"),
+		MakeString("Hello, Linus"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+
+	_, err = ctx.Eval(strings.NewReader(`repeat(3, 'ab')`))
+	if err == nil || !strings.Contains(err.Error(), "Mismatched types in call repeat(3, 'ab')") {
+		t.Errorf("Expected mismatched types error, got %v", err)
+	}
+	_, err = ctx.Eval(strings.NewReader(`repeat('ab')`))
+	if err == nil || !strings.Contains(err.Error(), "repeat requires 2 arguments, got 1") {
+		t.Errorf("Expected argument count error, got %v", err)
+	}
+
+	if err := ctx.LoadGoFunc("notFn", 42); err == nil {
+		t.Errorf("Expected binding a non-function to fail")
+	}
+}
@@ -0,0 +1,2290 @@
+package oak
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thesephist/oak/lib"
+)
+
+func (c *Context) requireArgLen(fnName string, args []Value, count int) *RuntimeError {
+	if len(args) < count {
+		return &RuntimeError{
+			reason: fmt.Sprintf("%s requires %d arguments, got %d", fnName, count, len(args)),
+		}
+	}
+
+	return nil
+}
+
+// BuiltinFn is a Go function that can be called from Oak programs. It returns
+// an error to stop evaluation of the program calling it.
+type BuiltinFn func([]Value) (Value, *RuntimeError)
+
+type BuiltinFnValue struct {
+	name string
+	fn   BuiltinFn
+}
+
+func (v BuiltinFnValue) String() string {
+	return fmt.Sprintf("fn %s { <native fn> }", v.name)
+}
+func (v BuiltinFnValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(BuiltinFnValue); ok {
+		return v.name == w.name
+	}
+	return false
+}
+
+// MakeBuiltinFn returns an Oak function with the given name that calls fn.
+func MakeBuiltinFn(name string, fn BuiltinFn) BuiltinFnValue {
+	return BuiltinFnValue{
+		name: name,
+		fn:   fn,
+	}
+}
+
+// LoadFunc defines a global function with the given name that calls fn.
+func (c *Context) LoadFunc(name string, fn BuiltinFn) {
+	c.scope.put(name, MakeBuiltinFn(name, fn))
+}
+
+// LoadBuiltins defines every builtin function in this Context.
+func (c *Context) LoadBuiltins() {
+	// core language and reflection
+	c.LoadFunc("import", c.oakImport)
+	c.LoadFunc("int", c.oakInt)
+	c.LoadFunc("float", c.oakFloat)
+	c.LoadFunc("atom", c.oakAtom)
+	c.LoadFunc("string", c.oakString)
+	c.LoadFunc("codepoint", c.oakCodepoint)
+	c.LoadFunc("char", c.oakChar)
+	c.LoadFunc("type", c.oakType)
+	c.LoadFunc("len", c.oakLen)
+	c.LoadFunc("keys", c.oakKeys)
+
+	// os interfaces
+	c.LoadFunc("args", c.oakArgs)
+	c.LoadFunc("env", c.oakEnv)
+	c.LoadFunc("time", c.oakTime)
+	c.LoadFunc("nanotime", c.oakNanotime)
+	c.LoadFunc("rand", c.oakRand)
+	c.LoadFunc("srand", c.oakSrand)
+	c.LoadFunc("wait", c.oakWait)
+	c.LoadFunc("timer", c.oakTimer)
+	c.LoadFunc("ticker", c.oakTicker)
+	c.LoadFunc("exit", c.oakExit)
+	c.LoadFunc("onerror", c.oakOnerror)
+	c.LoadFunc("signal", c.oakSignal)
+	c.LoadFunc("exec", c.callbackifyContext(c.oakExec))
+	c.LoadFunc("spawn", c.oakSpawn)
+
+	// i/o interfaces
+	c.LoadFunc("input", c.callbackify(c.oakInput))
+	c.LoadFunc("print", c.oakPrint)
+	c.LoadFunc("ls", c.callbackify(c.oakLs))
+	c.LoadFunc("rm", c.callbackify(c.oakRm))
+	c.LoadFunc("mkdir", c.callbackify(c.oakMkdir))
+	c.LoadFunc("stat", c.callbackify(c.oakStat))
+	c.LoadFunc("lstat", c.callbackify(c.oakLstat))
+	c.LoadFunc("rename", c.callbackify(c.oakRename))
+	c.LoadFunc("copy", c.callbackify(c.oakCopy))
+	c.LoadFunc("chmod", c.callbackify(c.oakChmod))
+	c.LoadFunc("symlink", c.callbackify(c.oakSymlink))
+	c.LoadFunc("readlink", c.callbackify(c.oakReadlink))
+	c.LoadFunc("walk", c.callbackify(c.oakWalk))
+	c.LoadFunc("watch", c.oakWatch)
+	c.LoadFunc("open", c.callbackify(c.oakOpen))
+	c.LoadFunc("close", c.callbackify(c.oakClose))
+	c.LoadFunc("read", c.callbackify(c.oakRead))
+	c.LoadFunc("write", c.callbackify(c.oakWrite))
+	c.LoadFunc("listen", c.oakListen)
+	c.LoadFunc("req", c.callbackifyContext(c.oakReq))
+	c.LoadFunc("tcpListen", c.oakTCPListen)
+	c.LoadFunc("tcpDial", c.oakTCPDial)
+	c.LoadFunc("udpListen", c.oakUDPListen)
+
+	// math
+	c.LoadFunc("sin", c.oakSin)
+	c.LoadFunc("cos", c.oakCos)
+	c.LoadFunc("tan", c.oakTan)
+	c.LoadFunc("asin", c.oakAsin)
+	c.LoadFunc("acos", c.oakAcos)
+	c.LoadFunc("atan", c.oakAtan)
+	c.LoadFunc("pow", c.oakPow)
+	c.LoadFunc("log", c.oakLog)
+
+	// language and runtime APIs
+	c.LoadFunc("___runtime_lib", c.rtLib)
+	c.LoadFunc("___runtime_lib?", c.rtIsLib)
+	c.LoadFunc("___runtime_tokenize", c.rtTokenize)
+	c.LoadFunc("___runtime_parse", c.rtParse)
+	c.LoadFunc("___runtime_gc", c.rtGC)
+	c.LoadFunc("___runtime_mem", c.rtMem)
+	c.LoadFunc("___runtime_proc", c.rtProc)
+}
+
+// MakeError returns an Oak error event {type: :error, error: message}, which
+// builtins return or pass to callbacks when an operation fails.
+func MakeError(message string) ObjectValue {
+	return errObj(message)
+}
+
+func errObj(message string) ObjectValue {
+	return ObjectValue{
+		"type":  AtomValue("error"),
+		"error": MakeString(message),
+	}
+}
+
+func (c *Context) callbackify(syncFn BuiltinFn) BuiltinFn {
+	return c.callbackifyContext(func(_ context.Context, args []Value) (Value, *RuntimeError) {
+		return syncFn(args)
+	})
+}
+
+// callbackifyContext is like callbackify, for builtins whose work is governed
+// by a Go context. When called with a callback, the work stays governed by the
+// engine's Go context at the time of the call, even if the engine's Go context
+// changes before the work is done.
+func (c *Context) callbackifyContext(syncFn func(goCtx context.Context, args []Value) (Value, *RuntimeError)) BuiltinFn {
+	return func(args []Value) (Value, *RuntimeError) {
+		goCtx := c.eng.goContext()
+		if len(args) == 0 {
+			return syncFn(goCtx, args)
+		}
+
+		lastArg := args[len(args)-1]
+		callback, isCallbackFn := lastArg.(FnValue)
+		if !isCallbackFn {
+			return syncFn(goCtx, args)
+		}
+
+		syncArgs := args[:len(args)-1]
+		c.eng.Add(1)
+		go func() {
+			defer c.eng.Done()
+
+			evt, err := syncFn(goCtx, syncArgs)
+			if goCtx.Err() != nil {
+				// the engine was torn down while the call was in flight
+				return
+			}
+			if err != nil {
+				c.eng.asyncError(err)
+				return
+			}
+
+			c.Lock()
+			defer c.Unlock()
+			_, err = c.EvalFnValue(callback, evt)
+			if err != nil && goCtx.Err() == nil {
+				c.eng.asyncError(err)
+				return
+			}
+		}()
+
+		return null, nil
+	}
+}
+
+func (c *Context) oakImport(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("import", args, 1); err != nil {
+		return nil, err
+	}
+
+	pathBytes, ok := args[0].(*StringValue)
+	if !ok {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("path to import() must be a string, got %s", args[0]),
+		}
+	}
+	pathStr := pathBytes.stringContent()
+
+	// if a registered module or stdlib, load it by name rather than from a file
+	if c.isModule(pathStr) {
+		return c.LoadLib(pathStr)
+	}
+
+	filePath := pathStr + ".oak"
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(c.rootPath, filePath)
+	}
+	if reason := c.fsDenial("import", filePath, false); reason != "" {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Could not open %s, %s", filePath, reason),
+		}
+	}
+
+	file, err := c.eng.fs.Open(filePath)
+	if err != nil {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Could not open %s, %s", filePath, err.Error()),
+		}
+	}
+	defer file.Close()
+
+	if imported, ok := c.eng.importMap[filePath]; ok {
+		return ObjectValue(imported.vars), nil
+	}
+
+	ctx := c.ChildContext(path.Dir(filePath))
+	c.eng.importMap[filePath] = ctx.scope
+	ctx.LoadBuiltins()
+
+	ctx.Unlock()
+	_, err = ctx.EvalFile(filePath, file)
+	ctx.Lock()
+	if err != nil {
+		if runtimeErr, ok := err.(*RuntimeError); ok {
+			return nil, runtimeErr
+		} else {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("Error importing %s: %s", pathStr, err.Error()),
+				cause:  err,
+			}
+		}
+	}
+
+	return ObjectValue(ctx.scope.vars), nil
+}
+
+func (c *Context) oakInt(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("int", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case IntValue:
+		return arg, nil
+	case FloatValue:
+		return IntValue(math.Floor(float64(arg))), nil
+	case *StringValue:
+		n, err := strconv.ParseInt(arg.stringContent(), 10, 64)
+		if err != nil {
+			return null, nil
+		}
+		return IntValue(n), nil
+	default:
+		return null, nil
+	}
+}
+
+func (c *Context) oakFloat(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("float", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case IntValue:
+		return FloatValue(arg), nil
+	case FloatValue:
+		return arg, nil
+	case *StringValue:
+		f, err := strconv.ParseFloat(arg.stringContent(), 64)
+		if err != nil {
+			return null, nil
+		}
+		return FloatValue(f), nil
+	default:
+		return null, nil
+	}
+}
+
+func (c *Context) oakAtom(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("atom", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case *StringValue:
+		return AtomValue(arg.stringContent()), nil
+	case AtomValue:
+		return arg, nil
+	default:
+		return AtomValue(arg.String()), nil
+	}
+}
+
+func (c *Context) oakString(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("string", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case *StringValue:
+		return arg, nil
+	case AtomValue:
+		return MakeString(string(arg)), nil
+	default:
+		return MakeString(arg.String()), nil
+	}
+}
+
+func (c *Context) oakCodepoint(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("codepoint", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case *StringValue:
+		if len(*arg) != 1 {
+			return null, nil
+		}
+		return IntValue(int64((*arg)[0])), nil
+	default:
+		return null, nil
+	}
+}
+
+func (c *Context) oakChar(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("char", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case IntValue:
+		codepoint := int64(arg)
+		if codepoint < 0 {
+			codepoint = 0
+		}
+		if codepoint > 255 {
+			codepoint = 255
+		}
+		bytes := StringValue([]byte{byte(codepoint)})
+		return &bytes, nil
+	default:
+		return null, nil
+	}
+}
+
+func (c *Context) oakType(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("type", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch args[0].(type) {
+	case NullValue:
+		return AtomValue("null"), nil
+	case EmptyValue:
+		return AtomValue("empty"), nil
+	case IntValue:
+		return AtomValue("int"), nil
+	case FloatValue:
+		return AtomValue("float"), nil
+	case BoolValue:
+		return AtomValue("bool"), nil
+	case AtomValue:
+		return AtomValue("atom"), nil
+	case *StringValue:
+		return AtomValue("string"), nil
+	case *ListValue:
+		return AtomValue("list"), nil
+	case ObjectValue:
+		return AtomValue("object"), nil
+	case FnValue, BuiltinFnValue:
+		return AtomValue("function"), nil
+	}
+
+	panic("Unreachable: unknown runtime value")
+}
+
+func (c *Context) oakLen(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("string", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case *StringValue:
+		return IntValue(len(*arg)), nil
+	case *ListValue:
+		return IntValue(len(*arg)), nil
+	case ObjectValue:
+		return IntValue(len(arg)), nil
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("%s does not support a len() call", arg),
+		}
+	}
+}
+
+func makeIntListUpTo(max int) Value {
+	list := make(ListValue, max)
+	for i := 0; i < max; i++ {
+		list[i] = IntValue(i)
+	}
+	return &list
+}
+
+func (c *Context) oakKeys(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("print", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case *StringValue:
+		return makeIntListUpTo(len(*arg)), nil
+	case *ListValue:
+		return makeIntListUpTo(len(*arg)), nil
+	case ObjectValue:
+		keys := make(ListValue, len(arg))
+		i := 0
+		for key := range arg {
+			keys[i] = MakeString(key)
+			i++
+		}
+		return &keys, nil
+	default:
+		return MakeList(), nil
+	}
+}
+
+func (c *Context) oakArgs(_ []Value) (Value, *RuntimeError) {
+	goArgs := os.Args
+	args := make(ListValue, len(goArgs))
+	for i, arg := range goArgs {
+		args[i] = MakeString(arg)
+	}
+	return &args, nil
+}
+
+func (c *Context) oakEnv(_ []Value) (Value, *RuntimeError) {
+	envVars := ObjectValue{}
+	for _, e := range os.Environ() {
+		kv := strings.SplitN(e, "=", 2)
+		envVars[kv[0]] = MakeString(kv[1])
+	}
+	return envVars, nil
+}
+
+func (c *Context) oakTime(_ []Value) (Value, *RuntimeError) {
+	unixSeconds := float64(c.eng.now().UnixNano()) / 1e9
+	return FloatValue(unixSeconds), nil
+}
+
+func (c *Context) oakNanotime(_ []Value) (Value, *RuntimeError) {
+	return IntValue(c.eng.now().UnixNano()), nil
+}
+
+func (c *Context) oakRand(_ []Value) (Value, *RuntimeError) {
+	return FloatValue(c.eng.rand.Float64()), nil
+}
+
+func (c *Context) oakSrand(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("srand", args, 1); err != nil {
+		return nil, err
+	}
+
+	bufLen, ok1 := args[0].(IntValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call srand(%s)", args[0]),
+		}
+	}
+
+	buf := make([]byte, bufLen)
+	_, err := crand.Read(buf)
+	if err != nil {
+		return null, nil
+	}
+
+	bytes := StringValue(buf)
+	return &bytes, nil
+}
+
+// waitDuration converts a number of seconds passed to a timer builtin into a
+// time.Duration.
+func waitDuration(fnName string, arg Value) (time.Duration, *RuntimeError) {
+	// in both Oak & Go, duration <= 0 results in immediate completion
+	switch arg := arg.(type) {
+	case IntValue:
+		return time.Duration(float64(arg) * float64(time.Second)), nil
+	case FloatValue:
+		return time.Duration(float64(arg) * float64(time.Second)), nil
+	default:
+		return 0, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call %s(%s)", fnName, arg),
+		}
+	}
+}
+
+func (c *Context) oakWait(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("wait", args, 1); err != nil {
+		return nil, err
+	}
+
+	// with a virtual clock, callbacks are queued on the clock rather than
+	// run after a real wait
+	if c.eng.clock != nil && len(args) > 1 {
+		if callback, ok := args[len(args)-1].(FnValue); ok {
+			duration, err := waitDuration("wait", args[0])
+			if err != nil {
+				return nil, err
+			}
+			c.startTimer(duration, false, callback)
+			return null, nil
+		}
+	}
+
+	return c.callbackifyContext(c.oakSleep)(args)
+}
+
+func (c *Context) oakSleep(goCtx context.Context, args []Value) (Value, *RuntimeError) {
+	duration, err := waitDuration("wait", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if c.eng.clock != nil {
+		c.eng.clock.sleep(duration)
+		return null, nil
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return null, nil
+	case <-goCtx.Done():
+		return nil, c.eng.canceledBy(goCtx)
+	}
+}
+
+// startTimer calls callback after d, and then every d after that if repeat is
+// set, until the returned function is called to cancel it. Cancelling reports
+// whether the timer was still pending. A pending timer holds a slot in the
+// engine's WaitGroup, and the timer's state is only accessed while holding the
+// interpreter lock.
+func (c *Context) startTimer(d time.Duration, repeat bool, callback Value) func() bool {
+	active := true
+	goCtx := c.eng.goContext()
+	run := func() {
+		if !repeat {
+			active = false
+		}
+		if _, err := c.EvalFnValue(callback, null); err != nil && goCtx.Err() == nil {
+			c.eng.asyncError(err)
+		}
+	}
+
+	if c.eng.clock != nil {
+		var cancelNext func() bool
+		var fire func()
+		fire = func() {
+			defer c.eng.Done()
+			if goCtx.Err() != nil {
+				return
+			}
+
+			c.Lock()
+			defer c.Unlock()
+			if !active {
+				return
+			}
+			if repeat {
+				// queue the next tick first, so the callback can cancel it
+				c.eng.Add(1)
+				cancelNext = c.eng.clock.schedule(d, fire)
+			}
+			run()
+		}
+
+		c.eng.Add(1)
+		cancelNext = c.eng.clock.schedule(d, fire)
+		return func() bool {
+			if !active {
+				return false
+			}
+			active = false
+			if cancelNext() {
+				c.eng.Done()
+			}
+			return true
+		}
+	}
+
+	stop := make(chan struct{})
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+
+		var tick <-chan time.Time
+		if repeat {
+			ticker := time.NewTicker(d)
+			defer ticker.Stop()
+			tick = ticker.C
+		} else {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			tick = timer.C
+		}
+
+		for {
+			select {
+			case <-tick:
+				c.Lock()
+				if !active || goCtx.Err() != nil {
+					c.Unlock()
+					return
+				}
+				run()
+				c.Unlock()
+				if !repeat {
+					return
+				}
+			case <-stop:
+				return
+			case <-goCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() bool {
+		if !active {
+			return false
+		}
+		active = false
+		close(stop)
+		return true
+	}
+}
+
+// timerHandle returns the Oak object for a timer, with a function to cancel
+// it.
+func timerHandle(cancel func() bool) ObjectValue {
+	return ObjectValue{
+		"type": AtomValue("timer"),
+		"cancel": MakeBuiltinFn("cancel", func(_ []Value) (Value, *RuntimeError) {
+			return BoolValue(cancel()), nil
+		}),
+	}
+}
+
+func (c *Context) oakTimer(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("timer", args, 2); err != nil {
+		return nil, err
+	}
+
+	duration, err := waitDuration("timer", args[0])
+	if err != nil {
+		return nil, err
+	}
+	callback, ok := args[1].(FnValue)
+	if !ok {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call timer(%s, %s)", args[0], args[1]),
+		}
+	}
+
+	return timerHandle(c.startTimer(duration, false, callback)), nil
+}
+
+func (c *Context) oakTicker(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("ticker", args, 2); err != nil {
+		return nil, err
+	}
+
+	duration, err := waitDuration("ticker", args[0])
+	if err != nil {
+		return nil, err
+	}
+	callback, ok := args[1].(FnValue)
+	if !ok {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call ticker(%s, %s)", args[0], args[1]),
+		}
+	}
+	if duration <= 0 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("ticker() requires a positive duration, got %s", args[0]),
+		}
+	}
+
+	return timerHandle(c.startTimer(duration, true, callback)), nil
+}
+
+func (c *Context) oakExit(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("exit", args, 1); err != nil {
+		return nil, err
+	}
+	if denied := c.deny("exit", c.policy.Exit); denied != nil {
+		return denied, nil
+	}
+
+	switch arg := args[0].(type) {
+	case IntValue:
+		c.eng.exit(int(arg))
+		return nil, c.eng.canceled()
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call exit(%s)", args[0]),
+		}
+	}
+}
+
+func (c *Context) oakExec(goCtx context.Context, args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("exec", args, 3); err != nil {
+		return nil, err
+	}
+	if denied := c.deny("exec", c.policy.Exec); denied != nil {
+		return denied, nil
+	}
+
+	path, ok1 := args[0].(*StringValue)
+	cliArgs, ok2 := args[1].(*ListValue)
+	stdin, ok3 := args[2].(*StringValue)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call exec(%s, %s, %s)", args[0], args[1], args[2]),
+		}
+	}
+
+	argsList := make([]string, len(*cliArgs))
+	for i, arg := range *cliArgs {
+		if argStr, ok := arg.(*StringValue); ok {
+			argsList[i] = argStr.stringContent()
+		} else {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("Mismatched types in call exec, arguments must be strings in %s", cliArgs),
+			}
+		}
+	}
+
+	cmd := exec.CommandContext(goCtx, path.stringContent(), argsList...)
+	stdoutBuf := bytes.Buffer{}
+	stderrBuf := bytes.Buffer{}
+	cmd.Stdin = strings.NewReader(stdin.stringContent())
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+
+	err := cmd.Start()
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not start command in exec(): %s", err.Error())), nil
+	}
+
+	exitCode := exitStatus(cmd.Wait())
+
+	stdout, err := io.ReadAll(&stdoutBuf)
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not read stdout from exec(): %s", err.Error())), nil
+	}
+	stdoutVal := StringValue(stdout)
+	stderr, err := io.ReadAll(&stderrBuf)
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not read stderr from exec(): %s", err.Error())), nil
+	}
+	stderrVal := StringValue(stderr)
+
+	return ObjectValue{
+		"type":   AtomValue("end"),
+		"status": IntValue(exitCode),
+		"stdout": &stdoutVal,
+		"stderr": &stderrVal,
+	}, nil
+}
+
+func (c *Context) oakInput(_ []Value) (Value, *RuntimeError) {
+	c.eng.stdin.Lock()
+	str, err := c.eng.stdin.ReadString('\n')
+	c.eng.stdin.Unlock()
+	if err == io.EOF {
+		return ObjectValue{
+			"type":  AtomValue("error"),
+			"error": MakeString("EOF"),
+			// if any data was read before encountering EOF, ensure the caller
+			// still gets that data.
+			"data": MakeString(str),
+		}, nil
+	} else if err != nil {
+		return errObj(fmt.Sprintf("Could not read input: %s", err.Error())), nil
+	}
+
+	inputStr := strings.TrimSuffix(str, "\n")
+
+	return ObjectValue{
+		"type": AtomValue("data"),
+		"data": MakeString(inputStr),
+	}, nil
+}
+
+func (c *Context) oakPrint(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("print", args, 1); err != nil {
+		return nil, err
+	}
+
+	outputString, ok := args[0].(*StringValue)
+	if !ok {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Unexpected argument to print: %s", args[0]),
+		}
+	}
+
+	n, _ := c.eng.stdout.Write(*outputString)
+	return IntValue(n), nil
+}
+
+func (c *Context) oakLs(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("ls", args, 1); err != nil {
+		return nil, err
+	}
+
+	dirPath, ok1 := args[0].(*StringValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call ls(%s)", args[0]),
+		}
+	}
+
+	if denied := c.denyFS("ls", dirPath.stringContent(), false); denied != nil {
+		return denied, nil
+	}
+
+	entries, err := c.eng.fs.ReadDir(dirPath.stringContent())
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not list directory %s: %s", dirPath.stringContent(), err.Error())), nil
+	}
+
+	fileList := make(ListValue, len(entries))
+	for i, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil {
+			return errObj(fmt.Sprintf("Could not list directory %s: %s", dirPath.stringContent(), err.Error())), nil
+		}
+		fileList[i] = statObject(fi)
+	}
+
+	return ObjectValue{
+		"type": AtomValue("data"),
+		"data": &fileList,
+	}, nil
+}
+
+func (c *Context) oakRm(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("rm", args, 1); err != nil {
+		return nil, err
+	}
+
+	rmPath, ok1 := args[0].(*StringValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call rm(%s)", args[0]),
+		}
+	}
+
+	if denied := c.denyFS("rm", rmPath.stringContent(), true); denied != nil {
+		return denied, nil
+	}
+
+	err := c.eng.fs.RemoveAll(rmPath.stringContent())
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not remove %s: %s", rmPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("end"),
+	}, nil
+}
+
+func (c *Context) oakMkdir(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("mkdir", args, 1); err != nil {
+		return nil, err
+	}
+
+	dirPath, ok1 := args[0].(*StringValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call mkdir(%s)", args[0]),
+		}
+	}
+
+	if denied := c.denyFS("mkdir", dirPath.stringContent(), true); denied != nil {
+		return denied, nil
+	}
+
+	err := c.eng.fs.MkdirAll(dirPath.stringContent(), 0755)
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not make a new directory %s: %s", dirPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("end"),
+	}, nil
+}
+
+func (c *Context) oakStat(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("stat", args, 1); err != nil {
+		return nil, err
+	}
+
+	statPath, ok1 := args[0].(*StringValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call stat(%s)", args[0]),
+		}
+	}
+
+	if denied := c.denyFS("stat", statPath.stringContent(), false); denied != nil {
+		return denied, nil
+	}
+
+	fileInfo, err := c.eng.fs.Stat(statPath.stringContent())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ObjectValue{
+				"type": AtomValue("data"),
+				"data": null,
+			}, nil
+		}
+		return errObj(fmt.Sprintf("Could not stat file %s: %s", statPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("data"),
+		"data": statObject(fileInfo),
+	}, nil
+}
+
+// statObject returns the Oak object describing a file in results of stat(),
+// lstat(), ls(), and walk().
+func statObject(fi fs.FileInfo) ObjectValue {
+	return ObjectValue{
+		"name":    MakeString(fi.Name()),
+		"len":     IntValue(fi.Size()),
+		"dir":     BoolValue(fi.IsDir()),
+		"mod":     IntValue(fi.ModTime().Unix()),
+		"perm":    IntValue(fi.Mode().Perm()),
+		"mode":    MakeString(fi.Mode().String()),
+		"symlink": BoolValue(fi.Mode()&fs.ModeSymlink != 0),
+	}
+}
+
+func (c *Context) oakLstat(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("lstat", args, 1); err != nil {
+		return nil, err
+	}
+
+	statPath, ok1 := args[0].(*StringValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call lstat(%s)", args[0]),
+		}
+	}
+
+	if denied := c.denyFS("lstat", statPath.stringContent(), false); denied != nil {
+		return denied, nil
+	}
+
+	var fileInfo fs.FileInfo
+	var err error
+	if symlinkFS, ok := c.eng.fs.(SymlinkFS); ok {
+		fileInfo, err = symlinkFS.Lstat(statPath.stringContent())
+	} else {
+		fileInfo, err = c.eng.fs.Stat(statPath.stringContent())
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ObjectValue{
+				"type": AtomValue("data"),
+				"data": null,
+			}, nil
+		}
+		return errObj(fmt.Sprintf("Could not stat file %s: %s", statPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("data"),
+		"data": statObject(fileInfo),
+	}, nil
+}
+
+func (c *Context) oakRename(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("rename", args, 2); err != nil {
+		return nil, err
+	}
+
+	fromPath, ok1 := args[0].(*StringValue)
+	toPath, ok2 := args[1].(*StringValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call rename(%s, %s)", args[0], args[1]),
+		}
+	}
+
+	if denied := c.denyFS("rename", fromPath.stringContent(), true); denied != nil {
+		return denied, nil
+	}
+	if denied := c.denyFS("rename", toPath.stringContent(), true); denied != nil {
+		return denied, nil
+	}
+
+	renameFS, ok := c.eng.fs.(RenameFS)
+	if !ok {
+		return errObj(fmt.Sprintf("Could not rename %s: %s", fromPath.stringContent(), errNotSupported.Error())), nil
+	}
+	err := renameFS.Rename(fromPath.stringContent(), toPath.stringContent())
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not rename %s: %s", fromPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("end"),
+	}, nil
+}
+
+func (c *Context) oakCopy(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("copy", args, 2); err != nil {
+		return nil, err
+	}
+
+	fromPath, ok1 := args[0].(*StringValue)
+	toPath, ok2 := args[1].(*StringValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call copy(%s, %s)", args[0], args[1]),
+		}
+	}
+
+	if denied := c.denyFS("copy", fromPath.stringContent(), false); denied != nil {
+		return denied, nil
+	}
+	if denied := c.denyFS("copy", toPath.stringContent(), true); denied != nil {
+		return denied, nil
+	}
+
+	copyErr := func(err error) Value {
+		return errObj(fmt.Sprintf("Could not copy %s: %s", fromPath.stringContent(), err.Error()))
+	}
+
+	src, err := c.eng.fs.Open(fromPath.stringContent())
+	if err != nil {
+		return copyErr(err), nil
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return copyErr(err), nil
+	}
+	if info.IsDir() {
+		return copyErr(errors.New("is a directory")), nil
+	}
+	// opening the destination truncates it, which would lose the source
+	if dstInfo, err := c.eng.fs.Stat(toPath.stringContent()); err == nil && sameFile(info, dstInfo) {
+		return copyErr(fmt.Errorf("%s is the same file", toPath.stringContent())), nil
+	}
+
+	dst, err := c.eng.fs.OpenFile(toPath.stringContent(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return copyErr(err), nil
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return copyErr(err), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("end"),
+	}, nil
+}
+
+func (c *Context) oakChmod(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("chmod", args, 2); err != nil {
+		return nil, err
+	}
+
+	chmodPath, ok1 := args[0].(*StringValue)
+	perm, ok2 := args[1].(IntValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call chmod(%s, %s)", args[0], args[1]),
+		}
+	}
+
+	if denied := c.denyFS("chmod", chmodPath.stringContent(), true); denied != nil {
+		return denied, nil
+	}
+
+	chmodFS, ok := c.eng.fs.(ChmodFS)
+	if !ok {
+		return errObj(fmt.Sprintf("Could not change permissions of %s: %s", chmodPath.stringContent(), errNotSupported.Error())), nil
+	}
+	err := chmodFS.Chmod(chmodPath.stringContent(), fs.FileMode(perm)&fs.ModePerm)
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not change permissions of %s: %s", chmodPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("end"),
+	}, nil
+}
+
+func (c *Context) oakSymlink(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("symlink", args, 2); err != nil {
+		return nil, err
+	}
+
+	target, ok1 := args[0].(*StringValue)
+	linkPath, ok2 := args[1].(*StringValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call symlink(%s, %s)", args[0], args[1]),
+		}
+	}
+
+	if denied := c.denyFS("symlink", linkPath.stringContent(), true); denied != nil {
+		return denied, nil
+	}
+
+	symlinkFS, ok := c.eng.fs.(SymlinkFS)
+	if !ok {
+		return errObj(fmt.Sprintf("Could not create symlink %s: %s", linkPath.stringContent(), errNotSupported.Error())), nil
+	}
+	err := symlinkFS.Symlink(target.stringContent(), linkPath.stringContent())
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not create symlink %s: %s", linkPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("end"),
+	}, nil
+}
+
+func (c *Context) oakReadlink(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("readlink", args, 1); err != nil {
+		return nil, err
+	}
+
+	linkPath, ok1 := args[0].(*StringValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call readlink(%s)", args[0]),
+		}
+	}
+
+	if denied := c.denyFS("readlink", linkPath.stringContent(), false); denied != nil {
+		return denied, nil
+	}
+
+	symlinkFS, ok := c.eng.fs.(SymlinkFS)
+	if !ok {
+		return errObj(fmt.Sprintf("Could not read symlink %s: %s", linkPath.stringContent(), errNotSupported.Error())), nil
+	}
+	target, err := symlinkFS.Readlink(linkPath.stringContent())
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not read symlink %s: %s", linkPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("data"),
+		"data": MakeString(target),
+	}, nil
+}
+
+func (c *Context) oakWalk(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("walk", args, 1); err != nil {
+		return nil, err
+	}
+
+	dirPath, ok1 := args[0].(*StringValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call walk(%s)", args[0]),
+		}
+	}
+
+	if denied := c.denyFS("walk", dirPath.stringContent(), false); denied != nil {
+		return denied, nil
+	}
+
+	fileList := ListValue{}
+	if err := c.walkDir(dirPath.stringContent(), &fileList); err != nil {
+		return errObj(fmt.Sprintf("Could not walk directory %s: %s", dirPath.stringContent(), err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("data"),
+		"data": &fileList,
+	}, nil
+}
+
+// walkDir appends every file under dir to fileList, with its path, parents
+// before their children and siblings in order by name. Symbolic links to
+// directories are listed but not followed.
+func (c *Context) walkDir(dir string, fileList *ListValue) error {
+	entries, err := c.eng.fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		entryPath := path.Join(dir, entry.Name())
+		file := statObject(fi)
+		file["path"] = MakeString(entryPath)
+		*fileList = append(*fileList, file)
+
+		if entry.IsDir() {
+			if err := c.walkDir(entryPath, fileList); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Context) oakOpen(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("open", args, 1); err != nil {
+		return nil, err
+	}
+
+	// flags arg is optional
+	if len(args) < 2 {
+		args = append(args, AtomValue("readwrite"))
+	}
+
+	// perm arg is optional
+	if len(args) < 3 {
+		args = append(args, IntValue(0644))
+	}
+
+	pathString, ok1 := args[0].(*StringValue)
+	flagsAtom, ok2 := args[1].(AtomValue)
+	permInt, ok3 := args[2].(IntValue)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call open(%s, %s, %s)", args[0], args[1], args[2]),
+		}
+	}
+
+	var flags int
+	switch string(flagsAtom) {
+	case "readonly":
+		flags = os.O_RDONLY
+	case "readwrite":
+		flags = os.O_RDWR | os.O_CREATE
+	case "append":
+		flags = os.O_RDWR | os.O_CREATE | os.O_APPEND
+	case "truncate":
+		flags = os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Invalid flag for open(): %s", flagsAtom),
+		}
+	}
+
+	if denied := c.denyFS("open", pathString.stringContent(), flags != os.O_RDONLY); denied != nil {
+		return denied, nil
+	}
+
+	file, err := c.eng.fs.OpenFile(pathString.stringContent(), flags, os.FileMode(permInt))
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not open file: %s", err.Error())), nil
+	}
+
+	c.eng.fdLock.Lock()
+	defer c.eng.fdLock.Unlock()
+
+	// files are numbered by the engine rather than the OS, so that files
+	// from any FS share one set of numbers, and like OS file descriptors, each
+	// gets the lowest number not in use after those of the standard streams
+	fd := uintptr(3)
+	for {
+		if _, used := c.eng.fileMap[fd]; !used {
+			break
+		}
+		fd++
+	}
+	c.eng.fileMap[fd] = file
+
+	return ObjectValue{
+		"type": AtomValue("file"),
+		"fd":   IntValue(fd),
+	}, nil
+}
+
+func (c *Context) oakClose(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("close", args, 1); err != nil {
+		return nil, err
+	}
+
+	fdInt, ok1 := args[0].(IntValue)
+	if !ok1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call close(%s)", args[0]),
+		}
+	}
+
+	c.eng.fdLock.Lock()
+	defer c.eng.fdLock.Unlock()
+	file, ok := c.eng.fileMap[uintptr(fdInt)]
+
+	if !ok {
+		return errObj(fmt.Sprintf("Unknown fd %d", fdInt)), nil
+	}
+
+	err := file.Close()
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not close file: %s", err.Error())), nil
+	}
+
+	delete(c.eng.fileMap, uintptr(fdInt))
+	delete(c.eng.readers, uintptr(fdInt))
+
+	return ObjectValue{
+		"type": AtomValue("end"),
+	}, nil
+}
+
+func (c *Context) oakRead(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("read", args, 3); err != nil {
+		return nil, err
+	}
+
+	fdInt, ok1 := args[0].(IntValue)
+	if _, isNull := args[1].(NullValue); ok1 && isNull {
+		return c.readStream(uintptr(fdInt), args[2])
+	}
+	offsetInt, ok2 := args[1].(IntValue)
+	lengthInt, ok3 := args[2].(IntValue)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call read(%s, %s, %s)", args[0], args[1], args[2]),
+		}
+	}
+
+	c.eng.fdLock.Lock()
+	file, ok := c.eng.fileMap[uintptr(fdInt)]
+	// reading at an offset moves the file position, so any data buffered for
+	// reads without an offset no longer comes next
+	delete(c.eng.readers, uintptr(fdInt))
+	c.eng.fdLock.Unlock()
+
+	if !ok {
+		return errObj(fmt.Sprintf("Unknown fd %d", fdInt)), nil
+	}
+
+	offset := int64(offsetInt)
+	length := int64(lengthInt)
+
+	_, err := file.Seek(offset, 0)
+	if err != nil {
+		return errObj(fmt.Sprintf("Error reading file during seek: %s", err.Error())), nil
+	}
+
+	readBuf := make([]byte, length)
+	count, err := file.Read(readBuf)
+	if err != nil && err != io.EOF {
+		return errObj(fmt.Sprintf("Error reading file: %s", err.Error())), nil
+	}
+
+	fileData := StringValue(readBuf[:count])
+	return ObjectValue{
+		"type": AtomValue("data"),
+		"data": &fileData,
+	}, nil
+}
+
+// streamReader buffers reads from the current position of a file or stream,
+// for input() and reads without an offset.
+type streamReader struct {
+	sync.Mutex
+	*bufio.Reader
+}
+
+func newStreamReader(r io.Reader) *streamReader {
+	return &streamReader{Reader: bufio.NewReader(r)}
+}
+
+// readStream reads from the current position of the file at fd, or stdin if
+// fd is 0, either the given number of bytes or up to and including the given
+// delimiter. It returns fewer bytes only if the file ends first, and an :eof
+// event once no more data is left.
+func (c *Context) readStream(fd uintptr, until Value) (Value, *RuntimeError) {
+	var delim byte
+	var length int
+	switch arg := until.(type) {
+	case IntValue:
+		if arg < 0 {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("read() requires a non-negative length, got %s", arg),
+			}
+		}
+		length = int(arg)
+	case *StringValue:
+		if len(*arg) != 1 {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("read() requires a single-byte delimiter, got %s", arg),
+			}
+		}
+		delim = (*arg)[0]
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call read(%d, ?, %s)", fd, until),
+		}
+	}
+
+	reader := c.eng.stdin
+	if fd != 0 {
+		c.eng.fdLock.Lock()
+		file, ok := c.eng.fileMap[fd]
+		if !ok {
+			c.eng.fdLock.Unlock()
+			return errObj(fmt.Sprintf("Unknown fd %d", fd)), nil
+		}
+		if reader, ok = c.eng.readers[fd]; !ok {
+			reader = newStreamReader(file)
+			c.eng.readers[fd] = reader
+		}
+		c.eng.fdLock.Unlock()
+	}
+
+	reader.Lock()
+	defer reader.Unlock()
+
+	var data []byte
+	var err error
+	if _, isDelim := until.(*StringValue); isDelim {
+		data, err = reader.ReadBytes(delim)
+	} else {
+		data = make([]byte, length)
+		var count int
+		count, err = io.ReadFull(reader, data)
+		data = data[:count]
+		if err == io.ErrUnexpectedEOF {
+			err = nil
+		}
+	}
+	if err == io.EOF && len(data) > 0 {
+		err = nil
+	}
+	if err == io.EOF {
+		return ObjectValue{
+			"type": AtomValue("eof"),
+		}, nil
+	} else if err != nil {
+		return errObj(fmt.Sprintf("Error reading file: %s", err.Error())), nil
+	}
+
+	fileData := StringValue(data)
+	return ObjectValue{
+		"type": AtomValue("data"),
+		"data": &fileData,
+	}, nil
+}
+
+func (c *Context) oakWrite(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("write", args, 3); err != nil {
+		return nil, err
+	}
+
+	fdInt, ok1 := args[0].(IntValue)
+	offsetInt, ok2 := args[1].(IntValue)
+	dataString, ok3 := args[2].(*StringValue)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call write(%s, %s, %s)", args[0], args[1], args[2]),
+		}
+	}
+
+	c.eng.fdLock.Lock()
+	file, ok := c.eng.fileMap[uintptr(fdInt)]
+	c.eng.fdLock.Unlock()
+	if !ok {
+		return errObj(fmt.Sprintf("Unknown fd %d", fdInt)), nil
+	}
+
+	offset := int64(offsetInt)
+	writeBuf := []byte(*dataString)
+
+	var err error
+	if offset == -1 {
+		_, err = file.Seek(0, 2) // "2" is relative to end of file
+	} else {
+		_, err = file.Seek(offset, 0)
+	}
+	if err != nil {
+		return errObj(fmt.Sprintf("Error writing file during seek: %s", err.Error())), nil
+	}
+
+	_, err = file.Write(writeBuf)
+	if err != nil && err != io.EOF {
+		return errObj(fmt.Sprintf("Error writing file: %s", err.Error())), nil
+	}
+
+	return ObjectValue{
+		"type": AtomValue("end"),
+	}, nil
+}
+
+type oakHTTPHandler struct {
+	ctx         *Context
+	oakCallback FnValue
+}
+
+func (h oakHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := h.ctx
+	cb := h.oakCallback
+
+	// unmarshal request
+	method := r.Method
+	url := r.URL.String()
+	headers := ObjectValue{}
+	for key, values := range r.Header {
+		headers[key] = MakeString(strings.Join(values, ","))
+	}
+	var body *StringValue
+	if r.ContentLength == 0 {
+		body = MakeString("")
+	} else {
+		bodyBuf, err := io.ReadAll(r.Body)
+		if err != nil {
+			ctx.Lock()
+			_, err = ctx.EvalFnValue(cb, errObj(
+				fmt.Sprintf("Could not read request in listen(), %s", err.Error()),
+			))
+			ctx.Unlock()
+
+			if err != nil {
+				ctx.eng.asyncError(err)
+			}
+		}
+		bodyStr := StringValue(bodyBuf)
+		body = &bodyStr
+	}
+
+	// construct request object to pass to Oak, call handler
+	responseEnded := false
+	responses := make(chan Value, 1)
+	endHandler := func(args []Value) (Value, *RuntimeError) {
+		if err := ctx.requireArgLen("listen/end", args, 1); err != nil {
+			return nil, err
+		}
+
+		if responseEnded {
+			ctx.eng.asyncError(&RuntimeError{
+				reason: fmt.Sprintf("listen/end called more than once"),
+			})
+		}
+
+		responseEnded = true
+		responses <- args[0]
+
+		return null, nil
+	}
+
+	go func() {
+		ctx.Lock()
+		defer ctx.Unlock()
+
+		_, err := ctx.EvalFnValue(cb, ObjectValue{
+			"type": AtomValue("req"),
+			"req": ObjectValue{
+				"method":  MakeString(method),
+				"url":     MakeString(url),
+				"headers": headers,
+				"body":    body,
+			},
+			"end": BuiltinFnValue{
+				name: "end",
+				fn:   endHandler,
+			},
+		})
+		if err != nil {
+			if ctx.eng.canceled() == nil {
+				ctx.eng.asyncError(err)
+			}
+
+			// a handler that fails before responding should not leave the
+			// request hanging
+			if !responseEnded {
+				responseEnded = true
+				responses <- nil
+			}
+		}
+	}()
+
+	// validate responses
+	resp := <-responses
+	if resp == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rsp, isObject := resp.(ObjectValue)
+	if !isObject {
+		ctx.eng.asyncError(&RuntimeError{
+			reason: fmt.Sprintf("listen/end should return a response, got %s", resp),
+		})
+		return
+	}
+
+	// unmarshal response from the return value
+	// response = { status, headers, body }
+	statusVal, okStatus := rsp["status"]
+	headersVal, okHeaders := rsp["headers"]
+	bodyVal, okBody := rsp["body"]
+
+	resStatus, okStatus := statusVal.(IntValue)
+	resHeaders, okHeaders := headersVal.(ObjectValue)
+	resBody, okBody := bodyVal.(*StringValue)
+
+	if !okStatus || !okHeaders || !okBody {
+		ctx.eng.asyncError(&RuntimeError{
+			reason: fmt.Sprintf("listen/end returned malformed response, %s", rsp),
+		})
+		return
+	}
+
+	// write values to response
+	// Content-Length is automatically set for us by Go
+	for k, v := range resHeaders {
+		if str, isStr := v.(*StringValue); isStr {
+			w.Header().Set(k, str.stringContent())
+		} else {
+			ctx.eng.asyncError(&RuntimeError{
+				reason: fmt.Sprintf("Could not set response header, value %s was not a string", v),
+			})
+			return
+		}
+	}
+
+	code := int(resStatus)
+	// guard against invalid HTTP codes, which cause Go panics
+	// https://golang.org/src/net/http/server.go
+	if code < 100 || code > 599 {
+		ctx.eng.asyncError(&RuntimeError{
+			reason: fmt.Sprintf("Could not set response status code, code %d is not valid", code),
+		})
+		return
+	}
+
+	// status code write must follow all other header writes, since it sends
+	// the status
+	w.WriteHeader(int(resStatus))
+	_, err := w.Write(*resBody)
+	if err != nil {
+		ctx.Lock()
+		defer ctx.Unlock()
+
+		_, err = ctx.EvalFnValue(cb, errObj(
+			fmt.Sprintf("Error writing request body in listen/end: %s", err.Error()),
+		))
+		if err != nil {
+			ctx.eng.asyncError(err)
+		}
+	}
+}
+
+// unixAddrPrefix marks an address passed to listen() as a Unix domain socket
+// path rather than a TCP host and port.
+const unixAddrPrefix = "unix:"
+
+func (ctx *Context) oakListen(args []Value) (Value, *RuntimeError) {
+	if err := ctx.requireArgLen("listen", args, 2); err != nil {
+		return nil, err
+	}
+	if denied := ctx.deny("listen", ctx.policy.NetServer); denied != nil {
+		return denied, nil
+	}
+
+	host, ok1 := args[0].(*StringValue)
+	cb, ok2 := args[1].(FnValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call listen(%s)", args[0]),
+		}
+	}
+
+	sendErr := func(msg string) {
+		ctx.Lock()
+		defer ctx.Unlock()
+
+		_, err2 := ctx.EvalFnValue(cb, errObj(msg))
+		if err2 != nil {
+			ctx.eng.asyncError(err2)
+		}
+	}
+
+	// an address like unix:/path/to/sock listens on a Unix domain socket
+	network, addr := "tcp", host.stringContent()
+	if strings.HasPrefix(addr, unixAddrPrefix) {
+		network, addr = "unix", strings.TrimPrefix(addr, unixAddrPrefix)
+		if denied := ctx.denyOSPath("listen", addr, true); denied != nil {
+			return denied, nil
+		}
+	}
+
+	server := &http.Server{
+		Addr: addr,
+		Handler: oakHTTPHandler{
+			ctx:         ctx,
+			oakCallback: cb,
+		},
+	}
+
+	ctx.eng.Add(1)
+	go func() {
+		defer ctx.eng.Done()
+		ln, err := net.Listen(network, addr)
+		if err == nil {
+			if unixLn, ok := ln.(*net.UnixListener); ok {
+				// remove the socket file once the server closes
+				unixLn.SetUnlinkOnClose(true)
+			}
+			err = server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			sendErr(fmt.Sprintf("Error starting http server in listen(): %s", err.Error()))
+		}
+	}()
+
+	// tear down the server if the engine's Go context ends first
+	closed := make(chan struct{})
+	var closeOnce sync.Once
+	goCtx := ctx.eng.goContext()
+	go func() {
+		select {
+		case <-goCtx.Done():
+			server.Close()
+		case <-closed:
+		}
+	}()
+
+	closer := func(_ []Value) (Value, *RuntimeError) {
+		closeOnce.Do(func() { close(closed) })
+
+		// attempt graceful shutdown, concurrently, without blocking Oak
+		// evaluation thread
+		ctx.eng.Add(1)
+		go func() {
+			defer ctx.eng.Done()
+
+			err := server.Shutdown(context.Background())
+			if err != nil {
+				sendErr(fmt.Sprintf("Could not close server in listen/close: %s", err.Error()))
+			}
+		}()
+
+		return null, nil
+	}
+
+	return BuiltinFnValue{
+		name: "close",
+		fn:   closer,
+	}, nil
+}
+
+func (c *Context) oakReq(goCtx context.Context, args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("req", args, 1); err != nil {
+		return nil, err
+	}
+	if denied := c.deny("req", c.policy.NetClient); denied != nil {
+		return denied, nil
+	}
+
+	argErr := RuntimeError{
+		reason: fmt.Sprintf("Mismatched types in call req(%s)", args[0]),
+	}
+
+	data, ok1 := args[0].(ObjectValue)
+	if !ok1 {
+		return nil, &argErr
+	}
+
+	// unmarshal request data
+	methodVal, ok1 := data["method"]
+	urlVal, ok2 := data["url"]
+	headersVal, ok3 := data["headers"]
+	bodyVal, ok4 := data["body"]
+
+	// default args
+	if !ok1 {
+		methodVal = MakeString("GET")
+		ok1 = true
+	}
+	if !ok3 {
+		headersVal = ObjectValue{}
+		ok3 = true
+	}
+	if !ok4 {
+		bodyVal = MakeString("")
+		ok4 = true
+	}
+
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, &argErr
+	}
+
+	method, ok1 := methodVal.(*StringValue)
+	url, ok2 := urlVal.(*StringValue)
+	headers, ok3 := headersVal.(ObjectValue)
+	body, ok4 := bodyVal.(*StringValue)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return nil, &argErr
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			// do not follow redirects
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// a socket path sends the request over a Unix domain socket, regardless
+	// of the host in the URL
+	switch socketVal := data["socket"].(type) {
+	case nil, NullValue:
+	case *StringValue:
+		socketPath := socketVal.stringContent()
+		if denied := c.denyOSPath("req", socketPath, false); denied != nil {
+			return denied, nil
+		}
+		client.Transport = &http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socketPath)
+			},
+		}
+	default:
+		return nil, &argErr
+	}
+
+	req, err := http.NewRequestWithContext(
+		goCtx,
+		method.stringContent(),
+		url.stringContent(),
+		strings.NewReader(body.stringContent()),
+	)
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not initialize request in req(): %s", err.Error())), nil
+	}
+
+	// construct headers
+	// Content-Length is automatically set for us by Go
+	req.Header.Set("User-Agent", "") // remove Go's default user agent header
+	for k, v := range headers {
+		if valStr, ok := v.(*StringValue); ok {
+			req.Header.Set(k, valStr.stringContent())
+		} else {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("Could not set request header, value %s is not a string", v),
+			}
+		}
+	}
+
+	// send request
+	resp, err := client.Do(req)
+	if err != nil {
+		return errObj(fmt.Sprintf(fmt.Sprintf("Could not send request: %s", err.Error()))), nil
+	}
+	defer resp.Body.Close()
+
+	respStatus := IntValue(resp.StatusCode)
+	respHeaders := ObjectValue{}
+	for key, values := range resp.Header {
+		respHeaders[key] = MakeString(strings.Join(values, ","))
+	}
+
+	var respBody *StringValue
+	if resp.ContentLength == 0 {
+		respBody = MakeString("")
+	} else {
+		buf, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return errObj(fmt.Sprintf("Could not read response: %s", err.Error())), nil
+		}
+		strBuf := StringValue(buf)
+		respBody = &strBuf
+	}
+
+	return ObjectValue{
+		"type": AtomValue("resp"),
+		"resp": ObjectValue{
+			"status":  respStatus,
+			"headers": respHeaders,
+			"body":    respBody,
+		},
+	}, nil
+}
+
+func (c *Context) oakSin(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("sin", args, 1); err != nil {
+		return nil, err
+	}
+
+	var val float64
+	switch arg := args[0].(type) {
+	case IntValue:
+		val = float64(arg)
+	case FloatValue:
+		val = float64(arg)
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call sin(%s)", args[0]),
+		}
+	}
+
+	return FloatValue(math.Sin(val)), nil
+}
+
+func (c *Context) oakCos(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("cos", args, 1); err != nil {
+		return nil, err
+	}
+
+	var val float64
+	switch arg := args[0].(type) {
+	case IntValue:
+		val = float64(arg)
+	case FloatValue:
+		val = float64(arg)
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call cos(%s)", args[0]),
+		}
+	}
+
+	return FloatValue(math.Cos(val)), nil
+}
+
+func (c *Context) oakTan(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("tan", args, 1); err != nil {
+		return nil, err
+	}
+
+	var val float64
+	switch arg := args[0].(type) {
+	case IntValue:
+		val = float64(arg)
+	case FloatValue:
+		val = float64(arg)
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call tan(%s)", args[0]),
+		}
+	}
+
+	return FloatValue(math.Tan(val)), nil
+}
+
+func (c *Context) oakAsin(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("asin", args, 1); err != nil {
+		return nil, err
+	}
+
+	var val float64
+	switch arg := args[0].(type) {
+	case IntValue:
+		val = float64(arg)
+	case FloatValue:
+		val = float64(arg)
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call asin(%s)", args[0]),
+		}
+	}
+
+	if val > 1 || val < -1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("asin() takes a number in range [-1, 1], got %f", val),
+		}
+	}
+
+	return FloatValue(math.Asin(val)), nil
+}
+
+func (c *Context) oakAcos(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("acos", args, 1); err != nil {
+		return nil, err
+	}
+
+	var val float64
+	switch arg := args[0].(type) {
+	case IntValue:
+		val = float64(arg)
+	case FloatValue:
+		val = float64(arg)
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call acos(%s)", args[0]),
+		}
+	}
+
+	if val > 1 || val < -1 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("acos() takes a number in range [-1, 1], got %f", val),
+		}
+	}
+
+	return FloatValue(math.Acos(val)), nil
+}
+
+func (c *Context) oakAtan(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("atan", args, 1); err != nil {
+		return nil, err
+	}
+
+	var val float64
+	switch arg := args[0].(type) {
+	case IntValue:
+		val = float64(arg)
+	case FloatValue:
+		val = float64(arg)
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call atan(%s)", args[0]),
+		}
+	}
+
+	return FloatValue(math.Atan(val)), nil
+}
+
+func (c *Context) oakPow(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("pow", args, 2); err != nil {
+		return nil, err
+	}
+
+	var base float64
+	var exp float64
+	err := RuntimeError{
+		reason: fmt.Sprintf("Mismatched types in call pow(%s, %s)", args[0], args[1]),
+	}
+
+	switch arg := args[0].(type) {
+	case IntValue:
+		base = float64(arg)
+	case FloatValue:
+		base = float64(arg)
+	default:
+		return nil, &err
+	}
+
+	switch arg := args[1].(type) {
+	case IntValue:
+		exp = float64(arg)
+	case FloatValue:
+		exp = float64(arg)
+	default:
+		return nil, &err
+	}
+
+	if base == 0 && exp == 0 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("pow(0, 0) is not defined"),
+		}
+	} else if base < 0 && float64(int64(exp)) != exp {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("pow() of negative number to fractional exponent is not defined"),
+		}
+	}
+
+	return FloatValue(math.Pow(base, exp)), nil
+}
+
+func (c *Context) oakLog(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("log", args, 2); err != nil {
+		return nil, err
+	}
+
+	var base float64
+	var exp float64
+	err := RuntimeError{
+		reason: fmt.Sprintf("Mismatched types in call log(%s, %s)", args[0], args[1]),
+	}
+
+	switch arg := args[0].(type) {
+	case IntValue:
+		base = float64(arg)
+	case FloatValue:
+		base = float64(arg)
+	default:
+		return nil, &err
+	}
+
+	switch arg := args[1].(type) {
+	case IntValue:
+		exp = float64(arg)
+	case FloatValue:
+		exp = float64(arg)
+	default:
+		return nil, &err
+	}
+
+	if base == 0 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("log(0, _) is not defined"),
+		}
+	} else if exp == 0 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("log(_, 0) is not defined"),
+		}
+	}
+
+	// we use math.Log2 here because we want logs of base 2 to give exact
+	// answers, where we care less about other bases
+	return FloatValue(math.Log2(exp) / math.Log2(base)), nil
+}
+
+// ___runtime_lib returns the string content of the bundled standard library by
+// the given name, or ? otherwise.
+func (c *Context) rtLib(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("__runtime_lib", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case *StringValue:
+		libName := arg.stringContent()
+		if libSource, ok := lib.Sources[libName]; ok {
+			return MakeString(libSource), nil
+		}
+		return null, nil
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call ___runtime_lib(%s)", args[0]),
+		}
+	}
+}
+
+// ___runtime_lib? reports whether a bundled standard library by the given name exists
+func (c *Context) rtIsLib(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("__runtime_lib?", args, 1); err != nil {
+		return nil, err
+	}
+
+	switch arg := args[0].(type) {
+	case *StringValue:
+		libName := arg.stringContent()
+		_, ok := lib.Sources[libName]
+		return BoolValue(ok), nil
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call ___runtime_lib?(%s)", args[0]),
+		}
+	}
+}
+
+// ___runtime_tokenize returns every token in the given Oak source text,
+// including comments and newlines, in the form produced by syntax.tokenize
+func (c *Context) rtTokenize(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("___runtime_tokenize", args, 1); err != nil {
+		return nil, err
+	}
+
+	source, ok := args[0].(*StringValue)
+	if !ok {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call ___runtime_tokenize(%s)", args[0]),
+		}
+	}
+
+	tokenizer := newTokenizer(source.stringContent())
+	tokenizer.lossless = true
+	return newSyntaxEncoder(tokenizer.source).tokens(tokenizer.tokenize()), nil
+}
+
+// ___runtime_parse parses Oak source text, or a list of tokens from
+// ___runtime_tokenize, into a list of AST nodes in the form produced by
+// syntax.parse. If the program has syntax errors, it returns an error object
+// for the first one, listing all of them under errors.
+func (c *Context) rtParse(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("___runtime_parse", args, 1); err != nil {
+		return nil, err
+	}
+
+	var tokens []token
+	var encoder syntaxEncoder
+	switch arg := args[0].(type) {
+	case *StringValue:
+		tokenizer := newTokenizer(arg.stringContent())
+		tokens = tokenizer.tokenize()
+		encoder = newSyntaxEncoder(tokenizer.source)
+	case *ListValue:
+		var ok bool
+		if tokens, ok = decodeTokens(arg); !ok {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("Invalid token list in call ___runtime_parse(%s)", args[0]),
+			}
+		}
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call ___runtime_parse(%s)", args[0]),
+		}
+	}
+
+	parser := newParser(tokens)
+	nodes, errs := parser.parseAll()
+	if len(errs) > 0 {
+		return encoder.parseErrors(errs), nil
+	}
+	return encoder.nodes(nodes), nil
+}
+
+// ___runtime_gc runs a garbage collection cycle for both Oak and the
+// underlying Go runtime. It blocks until the GC cycle is complete.
+func (c *Context) rtGC(_ []Value) (Value, *RuntimeError) {
+	runtime.GC()
+	return null, nil
+}
+
+// ___runtime_mem reports a dictionary of memory usage statistics for diagnostics
+func (c *Context) rtMem(_ []Value) (Value, *RuntimeError) {
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+	return ObjectValue{
+		// number of allocations
+		"allocs": IntValue(memStats.Mallocs),
+		"frees":  IntValue(memStats.Frees),
+		"live":   IntValue(memStats.Mallocs - memStats.Frees),
+		// number of bytes
+		"heap": IntValue(memStats.HeapAlloc),
+		"virt": IntValue(memStats.HeapSys),
+		// total gc cycles count
+		"gcs": IntValue(memStats.NumGC),
+	}, nil
+}
+
+// ___runtime_proc returns metadata about the current process
+func (c *Context) rtProc(_ []Value) (Value, *RuntimeError) {
+	var exeValue Value
+	execPath, err := os.Executable()
+	if err == nil {
+		exeValue = MakeString(execPath)
+	} else {
+		exeValue = null
+	}
+
+	return ObjectValue{
+		"pid": IntValue(os.Getpid()),
+		"exe": exeValue,
+	}, nil
+}
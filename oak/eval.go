@@ -0,0 +1,1026 @@
+// Package oak implements the Oak programming language: its tokenizer, parser,
+// bytecode compiler and virtual machine, builtin functions, and standard
+// library. It can be used to embed Oak programs in Go programs.
+//
+// A Context evaluates Oak programs. Go programs can define global variables
+// and functions in a Context with Set and LoadFunc, and call Oak functions with
+// Call.
+package oak
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// byte slice helpers from the Ink interpreter source code,
+// github.com/thesephist/ink
+
+// zero-extend a slice of bytes to given length
+func zeroExtend(s []byte, max int) []byte {
+	if max <= len(s) {
+		return s
+	}
+
+	extended := make([]byte, max)
+	copy(extended, s)
+	return extended
+}
+
+// return the max length of two slices
+func maxLen(a, b []byte) int {
+	if alen, blen := len(a), len(b); alen < blen {
+		return blen
+	} else {
+		return alen
+	}
+}
+
+// Value is an Oak value. Values of each Oak type are represented by the types
+// EmptyValue, NullValue, *StringValue, IntValue, FloatValue, BoolValue,
+// AtomValue, *ListValue, ObjectValue, FnValue, and BuiltinFnValue.
+type Value interface {
+	String() string
+	Eq(Value) bool
+}
+
+type EmptyValue byte
+
+// interned "empty" value
+const empty EmptyValue = 0
+
+// Empty is the Oak value _, which is equal to every other value.
+const Empty = empty
+
+func (v EmptyValue) String() string {
+	return "_"
+}
+func (v EmptyValue) Eq(u Value) bool {
+	return true
+}
+
+// Null need not contain any data, so we use the most compact data
+// representation we can.
+type NullValue byte
+
+// interned "null"
+const null NullValue = 0
+
+// Null is the Oak value ?.
+const Null = null
+
+func (v NullValue) String() string {
+	return "?"
+}
+func (v NullValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if _, ok := u.(NullValue); ok {
+		return true
+	}
+	return false
+}
+
+type StringValue []byte
+
+func MakeString(s string) *StringValue {
+	v := StringValue(s)
+	return &v
+}
+func (v *StringValue) String() string {
+	return fmt.Sprintf("'%s'", string(*v))
+}
+func (v *StringValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(*StringValue); ok {
+		return bytes.Equal(*v, *w)
+	}
+	return false
+}
+func (v *StringValue) stringContent() string {
+	return string(*v)
+}
+
+type IntValue int64
+
+func MakeInt(n int64) IntValue {
+	return IntValue(n)
+}
+
+func (v IntValue) String() string {
+	return strconv.FormatInt(int64(v), 10)
+}
+func (v IntValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(IntValue); ok {
+		return v == w
+	} else if w, ok := u.(FloatValue); ok {
+		return FloatValue(v) == w
+	}
+
+	return false
+}
+
+type FloatValue float64
+
+func MakeFloat(f float64) FloatValue {
+	return FloatValue(f)
+}
+
+func (v FloatValue) String() string {
+	return strconv.FormatFloat(float64(v), 'g', -1, 64)
+}
+func (v FloatValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(FloatValue); ok {
+		return v == w
+	} else if w, ok := u.(IntValue); ok {
+		return v == FloatValue(w)
+	}
+
+	return false
+}
+
+type BoolValue bool
+
+func MakeBool(b bool) BoolValue {
+	return BoolValue(b)
+}
+
+// interned bools
+const oakTrue = BoolValue(true)
+const oakFalse = BoolValue(false)
+
+func (v BoolValue) String() string {
+	if v {
+		return "true"
+	}
+	return "false"
+}
+func (v BoolValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(BoolValue); ok {
+		return v == w
+	}
+
+	return false
+}
+
+type AtomValue string
+
+func MakeAtom(name string) AtomValue {
+	return AtomValue(name)
+}
+
+func (v AtomValue) String() string {
+	return ":" + string(v)
+}
+func (v AtomValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(AtomValue); ok {
+		return v == w
+	}
+
+	return false
+}
+
+type ListValue []Value
+
+func MakeList(xs ...Value) *ListValue {
+	v := ListValue(xs)
+	return &v
+}
+func (v *ListValue) String() string {
+	valStrings := make([]string, len(*v))
+	for i, val := range *v {
+		valStrings[i] = val.String()
+	}
+	return "[" + strings.Join(valStrings, ", ") + "]"
+}
+func (v *ListValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(*ListValue); ok {
+		if len(*v) != len(*w) {
+			return false
+		}
+
+		for i, el := range *v {
+			if !el.Eq((*w)[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+type ObjectValue map[string]Value
+
+func MakeObject(entries map[string]Value) ObjectValue {
+	if entries == nil {
+		entries = map[string]Value{}
+	}
+	return ObjectValue(entries)
+}
+
+// only used for efficient serialization to string
+type serializedObjEntry struct {
+	key  string
+	full string
+}
+
+func (v ObjectValue) String() string {
+	// TODO: fix how this deals with circular references
+	entries := make([]serializedObjEntry, len(v))
+
+	i := 0
+	for key, val := range v {
+		entries[i] = serializedObjEntry{
+			key:  key,
+			full: key + ": " + val.String(),
+		}
+		i++
+	}
+
+	// sort entries lexicographically for easier debugging use
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	sb := strings.Builder{}
+	sb.WriteString("{")
+	for i, entry := range entries {
+		if i != 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(entry.full)
+	}
+	sb.WriteString("}")
+
+	return sb.String()
+}
+func (v ObjectValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(ObjectValue); ok {
+		if len(v) != len(w) {
+			return false
+		}
+
+		for key, val := range v {
+			if wVal, ok := w[key]; ok {
+				if !val.Eq(wVal) {
+					return false
+				}
+			} else {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+type FnValue struct {
+	proto *fnProto
+	// call frame and global scope in which the function was defined
+	env     *frame
+	globals *scope
+}
+
+func (v FnValue) String() string {
+	return v.proto.defn.String()
+}
+func (v FnValue) Eq(u Value) bool {
+	if _, ok := u.(EmptyValue); ok {
+		return true
+	}
+
+	if w, ok := u.(FnValue); ok {
+		return v.proto == w.proto && v.env == w.env
+	}
+
+	return false
+}
+
+type scope struct {
+	parent *scope
+	vars   map[string]Value
+}
+
+func (sc *scope) get(name string) (Value, *RuntimeError) {
+	if v, ok := sc.vars[name]; ok {
+		return v, nil
+	}
+	if sc.parent != nil {
+		return sc.parent.get(name)
+	}
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("%s is undefined", name),
+	}
+}
+
+func (sc *scope) put(name string, v Value) {
+	sc.vars[name] = v
+}
+
+func (sc *scope) update(name string, v Value) *RuntimeError {
+	if _, ok := sc.vars[name]; ok {
+		sc.vars[name] = v
+		return nil
+	}
+	if sc.parent != nil {
+		return sc.parent.update(name, v)
+	}
+	return &RuntimeError{
+		reason: fmt.Sprintf("%s is undefined", name),
+	}
+}
+
+type engine struct {
+	// interpreter lock to ensure lack of data races
+	sync.Mutex
+	// interpreter event loop waitgroup
+	sync.WaitGroup
+	// for deduplicating imports
+	importMap map[string]scope
+	// modules registered by the host program, importable by name
+	modules map[string]Module
+	// file fd -> Go's File map
+	fileMap map[uintptr]File
+	// file fd -> buffered reader for reads without an offset
+	readers map[uintptr]*streamReader
+	fdLock  sync.Mutex
+	// filesystem for file builtins and imports
+	fs FS
+	// standard streams for programs in this engine
+	stdin  *streamReader
+	stdout io.Writer
+	stderr io.Writer
+	// log async error streams through this
+	reportErr func(error)
+	// how errors from async work are handled, the number of them so far,
+	// and the onerror() handler for AsyncErrorHandle
+	asyncErrMode AsyncErrorMode
+	asyncErrs    int32
+	errHandler   *asyncErrorHandler
+	// the Go context.Context governing evaluation and asynchronous work in
+	// this engine, which may be swapped in by EvalContext while callbacks are
+	// running on other goroutines
+	goCtx atomic.Value
+	// every Go context that has governed this engine and not yet ended, so
+	// that exit() can end them all
+	goCtxLock sync.Mutex
+	goCtxs    []goContext
+	// *RuntimeError that ended this engine, because a program called exit()
+	// or ran out of fuel, if any
+	endErr atomic.Value
+	// closed once the engine has ended
+	ended chan struct{}
+	// source of randomness for rand()
+	rand *rand.Rand
+	// virtual clock for timers and time(), or nil to use real time
+	clock *VirtualClock
+	// remaining evaluation steps, or nil if evaluation is not metered. Only
+	// accessed while holding the interpreter lock.
+	fuel *int64
+}
+
+type goContext struct {
+	context.Context
+	cancel context.CancelFunc
+}
+
+// setGoContext makes the engine's Go context one derived from goCtx, which
+// the engine can end itself when a program exits.
+func (e *engine) setGoContext(goCtx context.Context) {
+	goCtx, cancel := context.WithCancel(goCtx)
+
+	e.goCtxLock.Lock()
+	defer e.goCtxLock.Unlock()
+	if e.endErr.Load() != nil {
+		cancel()
+	}
+
+	live := e.goCtxs[:0]
+	for _, ctx := range e.goCtxs {
+		if ctx.Err() == nil {
+			live = append(live, ctx)
+		}
+	}
+	e.goCtxs = append(live, goContext{goCtx, cancel})
+	e.goCtx.Store(goContext{goCtx, cancel})
+}
+
+// scopeGoContext makes the engine's Go context one derived from goCtx, as
+// setGoContext does, until the returned function is called, which restores
+// the Go context from before. Asynchronous work started in the meantime stays
+// governed by goCtx.
+func (e *engine) scopeGoContext(goCtx context.Context) (restore func()) {
+	prev := e.goCtx.Load()
+	e.setGoContext(goCtx)
+	return func() {
+		e.goCtx.Store(prev)
+	}
+}
+
+// exit ends the engine, recording the given exit status.
+func (e *engine) exit(code int) {
+	exitErr := &ExitError{Code: code}
+	e.end(&RuntimeError{
+		reason: exitErr.Error(),
+		cause:  exitErr,
+	})
+}
+
+// end ends evaluation and all asynchronous work in the engine, as if its Go
+// context had been canceled, so that work stopped from then on fails with err.
+// Only the first call has any effect.
+func (e *engine) end(err *RuntimeError) {
+	e.goCtxLock.Lock()
+	defer e.goCtxLock.Unlock()
+	if e.endErr.Load() != nil {
+		return
+	}
+	e.endErr.Store(err)
+	close(e.ended)
+	for _, ctx := range e.goCtxs {
+		ctx.cancel()
+	}
+	e.goCtxs = nil
+}
+
+// goContext returns the Go context.Context governing this engine.
+func (e *engine) goContext() context.Context {
+	if ctx, ok := e.goCtx.Load().(goContext); ok {
+		return ctx.Context
+	}
+	return context.Background()
+}
+
+// canceled returns the error to report for work stopped because the engine's
+// Go context ended, or nil if it has not ended.
+func (e *engine) canceled() *RuntimeError {
+	return e.canceledBy(e.goContext())
+}
+
+// canceledBy is like canceled, for work governed by goCtx, which may be a Go
+// context the engine had earlier, in an EvalContext call.
+func (e *engine) canceledBy(goCtx context.Context) *RuntimeError {
+	if err := goCtx.Err(); err != nil {
+		if endErr, ok := e.endErr.Load().(*RuntimeError); ok {
+			return &RuntimeError{
+				reason: endErr.reason,
+				cause:  endErr.cause,
+			}
+		}
+		return cancelError(err)
+	}
+	return nil
+}
+
+// defaultMaxCallDepth is the default maximum number of nested, non-tail Oak
+// function calls in a Context.
+const defaultMaxCallDepth = 1000000
+
+type Context struct {
+	// shared interpreter state
+	eng *engine
+	// directory containing the root file of this context, used for loading
+	// other modules with relative paths / URLs
+	rootPath string
+	// calls nested deeper than this fail with a stack overflow error
+	maxCallDepth int
+	// capabilities granted to builtins called from this context
+	policy Policy
+	// top level ("global") scope of this context
+	scope
+}
+
+func NewContext(rootPath string) Context {
+	return NewContextWithPolicy(rootPath, AllowAllPolicy)
+}
+
+// NewContextWithPolicy creates a Context whose builtins, and those of any
+// modules it imports, may only do what the given policy permits.
+func NewContextWithPolicy(rootPath string, policy Policy) Context {
+	eng := engine{
+		importMap: map[string]scope{},
+		modules:   map[string]Module{},
+		fileMap:   map[uintptr]File{},
+		readers:   map[uintptr]*streamReader{},
+		ended:     make(chan struct{}),
+		fs:        osFS{},
+		stdin:     newStreamReader(os.Stdin),
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	eng.reportErr = func(err error) {
+		fmt.Fprintln(eng.stderr, err)
+	}
+	eng.setGoContext(context.Background())
+	return Context{
+		eng:          &eng,
+		rootPath:     rootPath,
+		maxCallDepth: defaultMaxCallDepth,
+		policy:       policy,
+		scope: scope{
+			parent: nil,
+			vars:   map[string]Value{},
+		},
+	}
+}
+
+func (c *Context) ChildContext(rootPath string) Context {
+	return Context{
+		eng:          c.eng,
+		rootPath:     rootPath,
+		maxCallDepth: c.maxCallDepth,
+		policy:       c.policy,
+		scope: scope{
+			parent: nil,
+			vars:   map[string]Value{},
+		},
+	}
+}
+
+// SetStdin sets the stream that input() reads from in this Context and every
+// Context sharing its engine, which is os.Stdin by default.
+func (c *Context) SetStdin(stdin io.Reader) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.stdin = newStreamReader(stdin)
+}
+
+// SetStdout sets the stream that print() writes to in this Context and every
+// Context sharing its engine, which is os.Stdout by default.
+func (c *Context) SetStdout(stdout io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.stdout = stdout
+}
+
+// SetStderr sets the stream that errors from asynchronous work, like
+// callbacks, are reported to in this Context and every Context sharing its
+// engine, which is os.Stderr by default.
+func (c *Context) SetStderr(stderr io.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.stderr = stderr
+}
+
+// SetErrorReporter sets the function called with errors from asynchronous
+// work, like callbacks, in this Context and every Context sharing its engine,
+// instead of printing them to its stderr.
+func (c *Context) SetErrorReporter(report func(error)) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.reportErr = report
+}
+
+// ReportError reports an error the way errors from asynchronous work in this
+// Context are reported, to its stderr or the function set with
+// SetErrorReporter, so that a host program can report errors from evaluating
+// programs alongside them.
+func (c *Context) ReportError(err error) {
+	c.eng.reportErr(err)
+}
+
+// SetMaxCallDepth sets the maximum number of nested function calls allowed in
+// programs run by this Context, past which calls fail with a stack overflow
+// error. Tail calls do not count towards the limit.
+func (c *Context) SetMaxCallDepth(depth int) {
+	c.maxCallDepth = depth
+}
+
+// SetGoContext sets the Go context.Context that governs evaluation in this
+// Context and every Context sharing its engine. When goCtx ends, running
+// programs stop with an error that unwraps to goCtx.Err(), and pending
+// asynchronous work like callbacks, timers, and servers is torn down.
+func (c *Context) SetGoContext(goCtx context.Context) {
+	c.eng.setGoContext(goCtx)
+}
+
+// SetRandSource sets the source of randomness for rand() in this Context and
+// every Context sharing its engine. By default, each engine has its own
+// source seeded with the time at which it was created.
+func (c *Context) SetRandSource(src rand.Source) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.rand = rand.New(src)
+}
+
+// ExitStatus returns the status code a program in this Context, or any
+// Context sharing its engine, passed to exit(), and whether one has exited.
+func (c *Context) ExitStatus() (int, bool) {
+	if endErr, ok := c.eng.endErr.Load().(*RuntimeError); ok {
+		if exitErr, ok := endErr.cause.(*ExitError); ok {
+			return exitErr.Code, true
+		}
+	}
+	return 0, false
+}
+
+// SetFuel limits the work programs in this Context, and every Context sharing
+// its engine, can do to the given number of evaluation steps. Each bytecode
+// instruction run, roughly one per expression evaluated, consumes one step.
+// Once fuel runs out, evaluation, including of callbacks from the event loop,
+// fails with an error for which errors.Is(err, ErrOutOfFuel) is true, and the
+// engine ends as it does when a program calls exit(): pending timers and I/O
+// are canceled and Wait returns.
+func (c *Context) SetFuel(fuel int64) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.fuel = &fuel
+}
+
+// Fuel reports the remaining fuel, and whether evaluation is metered at all.
+func (c *Context) Fuel() (int64, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if c.eng.fuel == nil {
+		return 0, false
+	}
+	return *c.eng.fuel, true
+}
+
+// SubContext returns a Context that shares this Context's interpreter state
+// and can read and update its global variables, but whose own top-level
+// definitions are not visible to this Context.
+func (c *Context) SubContext() Context {
+	return Context{
+		eng:          c.eng,
+		rootPath:     c.rootPath,
+		maxCallDepth: c.maxCallDepth,
+		policy:       c.policy,
+		scope: scope{
+			parent: &c.scope,
+			vars:   map[string]Value{},
+		},
+	}
+}
+
+// Get returns the value of the global variable with the given name.
+func (c *Context) Get(name string) (Value, bool) {
+	c.Lock()
+	defer c.Unlock()
+	v, err := c.scope.get(name)
+	return v, err == nil
+}
+
+// Set defines a global variable with the given name and value, visible to
+// programs evaluated afterwards.
+func (c *Context) Set(name string, v Value) {
+	c.Lock()
+	defer c.Unlock()
+	c.scope.put(name, v)
+}
+
+func (c *Context) Lock() {
+	c.eng.Lock()
+}
+
+func (c *Context) Unlock() {
+	c.eng.Unlock()
+}
+
+// Wait blocks until all asynchronous work started by programs in this
+// Context, like callbacks, timers, and servers, is done. With a virtual clock,
+// Wait also runs queued timers. Once a program exits or runs out of fuel, Wait
+// returns without waiting for work that cannot be interrupted, like reading
+// from stdin.
+func (c *Context) Wait() {
+	if c.eng.clock != nil {
+		c.runVirtualTimers()
+		return
+	}
+
+	idle := make(chan struct{})
+	go func() {
+		c.eng.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+	case <-c.eng.ended:
+	}
+}
+
+type stackEntry struct {
+	name string
+	pos
+}
+
+func (e stackEntry) String() string {
+	if e.name != "" {
+		return fmt.Sprintf("  in fn %s %s", e.name, e.pos)
+	}
+	return fmt.Sprintf("  in anonymous fn %s", e.pos)
+}
+
+// RuntimeError is an error raised while evaluating an Oak program, with the
+// position in source at which it occurred and the stack of function calls
+// that led to it.
+type RuntimeError struct {
+	reason string
+	pos
+	// the source text of the expression that raised the error
+	span
+	stackTrace []stackEntry
+	// the Go error that caused this error, if any
+	cause error
+}
+
+// NewRuntimeError returns a RuntimeError with the given message. Builtin
+// functions return one to stop evaluation with an error.
+func NewRuntimeError(reason string) *RuntimeError {
+	return &RuntimeError{reason: reason}
+}
+
+// ErrOutOfFuel is the cause of errors from evaluation that ran out of fuel.
+var ErrOutOfFuel = errors.New("out of fuel")
+
+func outOfFuelError() *RuntimeError {
+	return &RuntimeError{
+		reason: "Out of fuel, evaluation step limit reached",
+		cause:  ErrOutOfFuel,
+	}
+}
+
+// ExitError is the cause of errors from evaluation that ended because a
+// program called exit(). Once a program exits, its engine runs no more
+// callbacks and all evaluation in it fails with this error.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Exited with status %d", e.Code)
+}
+
+func cancelError(err error) *RuntimeError {
+	return &RuntimeError{
+		reason: fmt.Sprintf("Evaluation canceled: %s", err.Error()),
+		cause:  err,
+	}
+}
+
+// Unwrap allows errors.Is to recognize runtime errors caused by Go errors, in
+// particular context.Canceled and context.DeadlineExceeded for evaluation
+// stopped by a Go context.
+func (e *RuntimeError) Unwrap() error {
+	return e.cause
+}
+
+// maxPrintedStackEntries is the most stack trace entries printed for an
+// error. Longer stack traces, like those from a stack overflow, print entries
+// from either end with the rest elided.
+const maxPrintedStackEntries = 40
+
+func (e *RuntimeError) Error() string {
+	// a syntax error in an imported module is reported as is, with positions
+	// in that module
+	if syntaxErr, ok := e.cause.(*SyntaxError); ok {
+		return syntaxErr.Error()
+	}
+
+	entries := e.stackTrace
+	elided := 0
+	if len(entries) > maxPrintedStackEntries {
+		elided = len(entries) - maxPrintedStackEntries
+		entries = append(append([]stackEntry{}, entries[:maxPrintedStackEntries/2]...),
+			entries[len(entries)-maxPrintedStackEntries/2:]...)
+	}
+
+	trace := make([]string, 0, len(entries)+1)
+	for i, entry := range entries {
+		if elided > 0 && i == maxPrintedStackEntries/2 {
+			trace = append(trace, fmt.Sprintf("  ... %d more", elided))
+		}
+		trace = append(trace, entry.String())
+	}
+	// errors raised outside of any expression, like cancellation, have no
+	// position to report
+	msg := fmt.Sprintf("Runtime error: %s", e.reason)
+	if e.pos.line > 0 {
+		msg = fmt.Sprintf("Runtime error %s: %s", e.pos, e.reason)
+	}
+	if excerpt := e.span.excerpt(e.pos); excerpt != "" {
+		msg += "\n" + excerpt
+	}
+	if len(trace) > 0 {
+		msg += "\n" + strings.Join(trace, "\n")
+	}
+	return msg
+}
+
+// Eval evaluates the Oak program read from programReader in this Context and
+// returns the value of its last expression.
+func (c *Context) Eval(programReader io.Reader) (Value, error) {
+	return c.EvalFile("", programReader)
+}
+
+// EvalContext is like Eval, but stops evaluation with an error if goCtx ends
+// before the program finishes. The error unwraps to goCtx.Err(). goCtx also
+// governs any asynchronous work the program starts during the call, as with
+// SetGoContext, but later evaluation in this Context is not affected by it.
+func (c *Context) EvalContext(goCtx context.Context, programReader io.Reader) (Value, error) {
+	return c.evalFile(goCtx, "", programReader)
+}
+
+// EvalFile is like Eval, but positions in errors from the program refer to
+// the given file name.
+func (c *Context) EvalFile(fileName string, programReader io.Reader) (Value, error) {
+	return c.evalFile(nil, fileName, programReader)
+}
+
+// evalFile evaluates a program for EvalFile, under goCtx for the duration of
+// the call if it is not nil.
+func (c *Context) evalFile(goCtx context.Context, fileName string, programReader io.Reader) (Value, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if goCtx != nil {
+		defer c.eng.scopeGoContext(goCtx)()
+	}
+
+	program, err := io.ReadAll(programReader)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.eng.canceled(); err != nil {
+		return nil, err
+	}
+
+	tokenizer := newFileTokenizer(fileName, string(program))
+	tokens := tokenizer.tokenize()
+
+	parser := newParser(tokens)
+	nodes, errs := parser.parseAll()
+	if len(errs) > 0 {
+		return nil, &SyntaxError{Errors: errs}
+	}
+
+	// a nil *RuntimeError is not a nil error, so it is not returned as one
+	val, runtimeErr := c.runProgram(compileProgram(nodes), c.scope)
+	if runtimeErr != nil {
+		if errors.Is(runtimeErr, ErrOutOfFuel) {
+			c.eng.end(outOfFuelError())
+		}
+		return val, runtimeErr
+	}
+	return val, nil
+}
+
+// Call calls the Oak function or builtin fn with the given arguments and
+// returns its result.
+func (c *Context) Call(fn Value, args ...Value) (Value, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	val, err := c.EvalFnValue(fn, args...)
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// EvalFnValue is like Call, but expects the caller to hold the Context's lock,
+// as builtin functions do while they run.
+func (c *Context) EvalFnValue(maybeFn Value, args ...Value) (Value, *RuntimeError) {
+	if err := c.eng.canceled(); err != nil {
+		return nil, err
+	}
+
+	if fn, ok := maybeFn.(FnValue); ok {
+		m := newVM(c)
+		m.frames = append(m.frames, m.callFrameFor(fn, args))
+		return m.run()
+	} else if fn, ok := maybeFn.(BuiltinFnValue); ok {
+		return fn.fn(args)
+	}
+
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("%s is not a function and cannot be called", maybeFn),
+	}
+}
+
+func divisionByZeroErr() *RuntimeError {
+	return &RuntimeError{
+		reason: fmt.Sprintf("Division by zero"),
+	}
+}
+
+func intBinaryOp(op tokKind, left, right IntValue) (Value, *RuntimeError) {
+	switch op {
+	case plus:
+		return IntValue(left + right), nil
+	case minus:
+		return IntValue(left - right), nil
+	case times:
+		return IntValue(left * right), nil
+	case divide:
+		if right == 0 {
+			return nil, divisionByZeroErr()
+		}
+		return FloatValue(FloatValue(left) / FloatValue(right)), nil
+	case modulus:
+		if right == 0 {
+			return nil, divisionByZeroErr()
+		}
+		return IntValue(left % right), nil
+	case xor:
+		return IntValue(left ^ right), nil
+	case and:
+		return IntValue(left & right), nil
+	case or:
+		return IntValue(left | right), nil
+	case greater:
+		return BoolValue(left > right), nil
+	case less:
+		return BoolValue(left < right), nil
+	case geq:
+		return BoolValue(left >= right), nil
+	case leq:
+		return BoolValue(left <= right), nil
+	}
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("Invalid binary operator %s for ints %s, %s", token{kind: op}, left, right),
+	}
+}
+
+func floatBinaryOp(op tokKind, left, right FloatValue) (Value, *RuntimeError) {
+	switch op {
+	case plus:
+		return FloatValue(left + right), nil
+	case minus:
+		return FloatValue(left - right), nil
+	case times:
+		return FloatValue(left * right), nil
+	case divide:
+		if right == 0 {
+			return nil, divisionByZeroErr()
+		}
+		return FloatValue(left / right), nil
+	case modulus:
+		if right == 0 {
+			return nil, divisionByZeroErr()
+		}
+		return FloatValue(math.Mod(float64(left), float64(right))), nil
+	case greater:
+		return BoolValue(left > right), nil
+	case less:
+		return BoolValue(left < right), nil
+	case geq:
+		return BoolValue(left >= right), nil
+	case leq:
+		return BoolValue(left <= right), nil
+	}
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("Invalid binary operator %s for floats %s, %s", token{kind: op}, left, right),
+	}
+}
+
+func incompatibleError(op tokKind, left, right Value) *RuntimeError {
+	return &RuntimeError{
+		reason: fmt.Sprintf("Cannot %s incompatible values %s, %s",
+			token{kind: op}, left, right),
+	}
+}
@@ -0,0 +1,2556 @@
+package oak
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func expectProgramToReturn(t *testing.T, program string, expected Value) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	val, err := ctx.Eval(strings.NewReader(program))
+	if err != nil {
+		t.Errorf("Did not expect program to exit with error: %s", err.Error())
+	}
+	if val == nil {
+		t.Errorf("Return value of program should not be nil")
+	} else if !val.Eq(expected) {
+		t.Errorf(fmt.Sprintf("Expected and returned values don't match: %s != %s",
+			strconv.Quote(expected.String()),
+			strconv.Quote(val.String())))
+	}
+}
+
+func TestEvalEmptyProgram(t *testing.T) {
+	expectProgramToReturn(t, "", null)
+	expectProgramToReturn(t, "   \n", null)
+}
+
+func TestCommentProgram(t *testing.T) {
+	expectProgramToReturn(t, "// this is a comment", null)
+	expectProgramToReturn(t, "// this is a comment\n", null)
+}
+
+func TestCommentInBinaryExpr(t *testing.T) {
+	expectProgramToReturn(t, "1 + // this is a comment\n2", IntValue(3))
+}
+
+func TestCommentAndNewline(t *testing.T) {
+	expectProgramToReturn(t, "1 + 2 // this is a comment\n", IntValue(3))
+}
+
+func TestIdentifierAfterComment(t *testing.T) {
+	expectProgramToReturn(t, "x := 10 // this is a comment\nx + x", IntValue(20))
+}
+
+func TestEmptyLiteral(t *testing.T) {
+	expectProgramToReturn(t, "_", empty)
+}
+
+func TestNullLiteral(t *testing.T) {
+	expectProgramToReturn(t, "?", null)
+}
+
+func TestStringLiteral(t *testing.T) {
+	expectProgramToReturn(t, "'Hello, World!\\n'", MakeString("Hello, World!\n"))
+}
+
+func TestQuotedStringLiteral(t *testing.T) {
+	expectProgramToReturn(t, "'a\\'b'", MakeString("a'b"))
+}
+
+func TestStringLiteralOverflow(t *testing.T) {
+	expectProgramToReturn(t, "'\\", MakeString(""))
+	expectProgramToReturn(t, "'\\'", MakeString("'"))
+	expectProgramToReturn(t, "'\\x'", MakeString("x"))
+	expectProgramToReturn(t, "'\\x1'", MakeString("x1"))
+	expectProgramToReturn(t, "'\\x1g'", MakeString("x1g"))
+}
+
+func TestHexStringLiteral(t *testing.T) {
+	expectProgramToReturn(t, "'a\\x!'", MakeString("ax!"))
+	expectProgramToReturn(t, "'a\\x1!'", MakeString("ax1!"))
+	expectProgramToReturn(t, "'a\\x0a!'", MakeString("a\n!"))
+	expectProgramToReturn(t, "'a\\x0A!'", MakeString("a\n!"))
+	expectProgramToReturn(t, "'a\\x1z!'", MakeString("ax1z!"))
+
+	nonAsciiStringValue := StringValue([]byte{0x98})
+	expectProgramToReturn(t, "'\\x98'", &nonAsciiStringValue) // test out of ascii range
+}
+
+func TestIntegerLiteral(t *testing.T) {
+	expectProgramToReturn(t, "64710", IntValue(64710))
+}
+
+func TestFloatLiteral(t *testing.T) {
+	expectProgramToReturn(t, "100.0", FloatValue(100))
+	expectProgramToReturn(t, "3.141592", FloatValue(3.141592))
+}
+
+func TestAtomLiteral(t *testing.T) {
+	atomNames := []string{
+		"_?", "if", "fn", "with", "true", "false", "_if", "not_found_404",
+	}
+
+	for _, atomName := range atomNames {
+		expectProgramToReturn(t, ":"+atomName, AtomValue(atomName))
+	}
+}
+
+func TestKeywordLikeAtomLiteral(t *testing.T) {
+	expectProgramToReturn(t, ":if", AtomValue("if"))
+	expectProgramToReturn(t, ":fn", AtomValue("fn"))
+	expectProgramToReturn(t, ":with", AtomValue("with"))
+	expectProgramToReturn(t, ":true", AtomValue("true"))
+	expectProgramToReturn(t, ":false", AtomValue("false"))
+}
+
+func TestListLiteral(t *testing.T) {
+	expectProgramToReturn(t, `[1, [2, 'three'], :four]`, MakeList(
+		IntValue(1),
+		MakeList(
+			IntValue(2),
+			MakeString("three"),
+		),
+		AtomValue("four"),
+	))
+}
+
+func TestObjectLiteral(t *testing.T) {
+	expectProgramToReturn(t, `{ a: 'ay', :be: 200, 100: {('d' + 'i'): :dee } }`, ObjectValue{
+		"a":  MakeString("ay"),
+		"be": IntValue(200),
+		"100": ObjectValue{
+			"di": AtomValue("dee"),
+		},
+	})
+}
+
+func TestListStringify(t *testing.T) {
+	expectProgramToReturn(t, `
+		[
+			string(:atomValue)
+			string(3)
+			string(2.51)
+		]
+	`, MakeList(
+		MakeString("atomValue"),
+		MakeString("3"),
+		MakeString("2.51"),
+	))
+}
+
+func TestObjectStringify(t *testing.T) {
+	expectProgramToReturn(t, `
+		x := {
+			first: {}
+			second: :two
+			_third: {
+				_fourth: 'four'
+			}
+		}
+		x |> string()
+	`, MakeString("{_third: {_fourth: 'four'}, first: {}, second: :two}"))
+}
+
+func TestFunctionDefAndCall(t *testing.T) {
+	expectProgramToReturn(t, `fn getThree() { x := 4, 3 }, getThree()`, IntValue(3))
+}
+
+func TestFunctionDefWithEmpty(t *testing.T) {
+	expectProgramToReturn(t, `fn getThird(_, _, third) third, getThird(1, 2, 3)`, IntValue(3))
+}
+
+func TestFunctionCreatesScope(t *testing.T) {
+	expectProgramToReturn(t, `
+	x := 3
+	fn defineX x := 10
+	defineX()
+	x
+	`, IntValue(3))
+}
+
+func TestBlockCreatesScope(t *testing.T) {
+	expectProgramToReturn(t, `
+	x := 3
+	{ x := 10 }
+	x
+	`, IntValue(3))
+}
+
+func TestReadOuterBeforeShadowing(t *testing.T) {
+	expectProgramToReturn(t, `
+	x := 3
+	fn shadow {
+		y := x
+		x := 10
+		[x, y]
+	}
+	shadow()
+	`, MakeList(
+		IntValue(10),
+		IntValue(3),
+	))
+}
+
+func TestConditionalShadowing(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn read(shadow?) {
+		x := :outer
+		fn inner {
+			if shadow? -> x := :inner
+			x
+		}
+		inner()
+	}
+	[read(true), read(false)]
+	`, MakeList(
+		AtomValue("inner"),
+		AtomValue("outer"),
+	))
+}
+
+func TestMutualRecursionInFunction(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn run {
+		fn even?(n) if n {
+			0 -> true
+			_ -> odd?(n - 1)
+		}
+		fn odd?(n) if n {
+			0 -> false
+			_ -> even?(n - 1)
+		}
+		even?(10)
+	}
+	run()
+	`, oakTrue)
+}
+
+func TestEmptyFunctionBody(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn do {
+		a: :bee
+	}
+	do()
+	`, ObjectValue{
+		"a": AtomValue("bee"),
+	})
+}
+
+func TestObjectLiteralFunctionBody(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn do {}
+	do()
+	`, null)
+}
+
+func TestLocalAssignment(t *testing.T) {
+	expectProgramToReturn(t, `x := 100, y := 200, x`, IntValue(100))
+}
+
+func TestChainedLocalAssignment(t *testing.T) {
+	expectProgramToReturn(t, `
+	a := b := 10
+	a + b
+	`, IntValue(20))
+}
+
+func TestChainedNonlocalAssignment(t *testing.T) {
+	expectProgramToReturn(t, `
+	a := b := 0
+	{
+		a <- b <- 20
+	}
+	a + b
+	`, IntValue(40))
+}
+
+func TestDestructureList(t *testing.T) {
+	expectProgramToReturn(t, `
+	list := [1, 2, 3]
+	[a] := list
+	[_, _, b, c] := list
+	[a, b, c]
+	`, MakeList(
+		IntValue(1),
+		IntValue(3),
+		null,
+	))
+}
+
+func TestDestructureObject(t *testing.T) {
+	expectProgramToReturn(t, `
+	obj := {
+		a: 'ay'
+		b: 'bee'
+		12: 'see'
+	}
+	{a: a} := obj
+	{:b: b, 10 + 2: see} := {'whatever': dee} := obj
+	[a, b, see, dee]
+	`, MakeList(
+		MakeString("ay"),
+		MakeString("bee"),
+		MakeString("see"),
+		null,
+	))
+}
+
+func TestDestrctureToReassignList(t *testing.T) {
+	expectProgramToReturn(t, `
+	v := [:aa, :bbb]
+	[v, w] := v
+	v
+	`, AtomValue("aa"))
+}
+
+func TestDestrctureToReassignObject(t *testing.T) {
+	expectProgramToReturn(t, `
+	a := {a: :aa, b: :bbb}
+	{a: a} := a
+	a
+	`, AtomValue("aa"))
+}
+
+func TestUnderscoreVarNames(t *testing.T) {
+	expectProgramToReturn(t, `
+	_a := 'A'
+	b_ := 'B'
+	c_d := 'CD'
+	_a + b_ + c_d
+	`, MakeString("ABCD"))
+}
+
+func TestNonlocalAssignment(t *testing.T) {
+	expectProgramToReturn(t, `
+	x := 100
+	y := 200
+	fn do {
+		x <- x + 100
+		y := y + 100
+	}
+	do()
+	x + y
+	`, IntValue(400))
+}
+
+func TestPushToString(t *testing.T) {
+	expectProgramToReturn(t, `
+	s := 'hi'
+	[s << 'world', s]
+	`, MakeList(
+		MakeString("hiworld"),
+		MakeString("hiworld"),
+	))
+}
+
+func TestPushToList(t *testing.T) {
+	expectProgramToReturn(t, `
+	arr := [:a]
+	[arr << :b, arr]
+	`, MakeList(
+		MakeList(AtomValue("a"), AtomValue("b")),
+		MakeList(AtomValue("a"), AtomValue("b")),
+	))
+}
+
+func TestPushArrowPrecedence(t *testing.T) {
+	expectProgramToReturn(t, `
+	arr := [2] << 1 + 3
+	arr << 10 << 20
+	arr << x := 100
+	`, MakeList(
+		IntValue(2),
+		IntValue(4),
+		IntValue(10),
+		IntValue(20),
+		IntValue(100),
+	))
+}
+
+func TestUnaryExpr(t *testing.T) {
+	expectProgramToReturn(t, `!true`, oakFalse)
+	expectProgramToReturn(t, `!(false | true)`, oakFalse)
+
+	expectProgramToReturn(t, `-546`, IntValue(-546))
+	expectProgramToReturn(t, `-3.250`, FloatValue(-3.25))
+}
+
+func TestUnaryBindToProperty(t *testing.T) {
+	expectProgramToReturn(t, `!!false`, oakFalse)
+	expectProgramToReturn(t, `--3`, IntValue(3))
+	expectProgramToReturn(t, `
+	obj := {k: false, n: 10}
+	[!obj.k, -obj.n]
+	`, MakeList(
+		oakTrue,
+		IntValue(-10),
+	))
+}
+
+func TestBasicBinaryExpr(t *testing.T) {
+	expectProgramToReturn(t, `2 * 3 + 1`, IntValue(7))
+	expectProgramToReturn(t, `1 + 2 * 3`, IntValue(7))
+}
+
+func TestFloatDivide(t *testing.T) {
+	expectProgramToReturn(t, "10 / 4", FloatValue(2.5))
+}
+
+func TestOrderedBinaryExpr(t *testing.T) {
+	expectProgramToReturn(t, `-1.5 + -3.5 - 5 / 5 * 2`, FloatValue(-7))
+	expectProgramToReturn(t, `(-1.5 + -3.5 - 5) / 5 * 2`, FloatValue(-4))
+}
+
+func TestBinaryExprWithParens(t *testing.T) {
+	expectProgramToReturn(t, `(1 + 2) / 3 - 1 + (10 + (20 / 5)) % 3`, FloatValue(2))
+}
+
+func TestLongBinaryExprWithPrecedence(t *testing.T) {
+	expectProgramToReturn(t, `x := 1 + 2 * 3 + 4 / 2 + 10 % 4, x % 5 + x`, FloatValue(12))
+}
+
+func TestBinaryExprWithComplexTerms(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn double(n) 2 * n
+	fn decrement(n) n - 1
+	double(10) + if decrement(10) { 9 -> 2, _ -> 1 } + 8
+	`, IntValue(30))
+}
+
+func TestBinaryExprWithinComplexTermsWithinBinaryExpr(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn inc(n) n + 1
+	2 * inc(3 + 4)
+	`, IntValue(16))
+}
+
+func TestStringCompare(t *testing.T) {
+	expectProgramToReturn(t, `
+	[
+		// empty string
+		'long string' > ''
+		// length comparison
+		'hi' < 'hiworld'
+		// lexicographical
+		'heels' < 'hi'
+		// space
+		'abc' > ' abc'
+		// equality
+		'abc' = 'abc'
+	]
+	`, MakeList(oakTrue, oakTrue, oakTrue, oakTrue, oakTrue))
+}
+
+func TestAndOperator(t *testing.T) {
+	expectProgramToReturn(t, `
+	[
+		true & true
+		true & false
+		false & true
+		false & false
+		'abcd' & '    '
+		'    ' & 'wxyz'
+		'abcdef' & '   '
+		'   ' & 'abcdef'
+	]
+	`, MakeList(
+		oakTrue,
+		oakFalse,
+		oakFalse,
+		oakFalse,
+		MakeString("    "),
+		MakeString("    "),
+		MakeString("   \x00\x00\x00"),
+		MakeString("   \x00\x00\x00"),
+	))
+}
+
+func TestXorOperator(t *testing.T) {
+	expectProgramToReturn(t, `
+	[
+		true ^ true
+		true ^ false
+		false ^ true
+		false ^ false
+		'ABCD' ^ '    '
+		'    ' ^ 'WXYZ'
+		'ABCDEF' ^ '   '
+		'   ' ^ 'ABCDEF'
+	]
+	`, MakeList(
+		oakFalse,
+		oakTrue,
+		oakTrue,
+		oakFalse,
+		MakeString("abcd"),
+		MakeString("wxyz"),
+		MakeString("abcDEF"),
+		MakeString("abcDEF"),
+	))
+}
+
+func TestOrOperator(t *testing.T) {
+	expectProgramToReturn(t, `
+	[
+		true | true
+		true | false
+		false | true
+		false | false
+		'ABCD' | '    '
+		'    ' | 'WXYZ'
+		'ABCDEF' | '   '
+		'   ' | 'ABCDEF'
+	]
+	`, MakeList(
+		oakTrue,
+		oakTrue,
+		oakTrue,
+		oakFalse,
+		MakeString("abcd"),
+		MakeString("wxyz"),
+		MakeString("abcDEF"),
+		MakeString("abcDEF"),
+	))
+}
+
+func TestShortCircuitingAnd(t *testing.T) {
+	expectProgramToReturn(t, `
+	x := 3
+	[
+		false & 2
+		false & { x <- 10, true }
+		x
+	]
+	`, MakeList(oakFalse, oakFalse, IntValue(3)))
+}
+
+func TestShortCircuitingOr(t *testing.T) {
+	expectProgramToReturn(t, `
+	x := 3
+	[
+		true | 2
+		true | { x <- 10, false }
+		x
+	]
+	`, MakeList(oakTrue, oakTrue, IntValue(3)))
+}
+
+func TestEmptyIfExpr(t *testing.T) {
+	expectProgramToReturn(t, `if 100 {}`, null)
+}
+
+func TestEmptyIfCondition(t *testing.T) {
+	expectProgramToReturn(t, `if {
+		false -> 10
+		true -> 20
+		_ -> 30
+	}`, IntValue(20))
+}
+
+func TestBasicIfExpr(t *testing.T) {
+	expectProgramToReturn(t, `if 2 * 2 {
+		? -> 100
+		{ a: 'b' } -> 200
+		5 -> 'five'
+		4 -> 'four'
+	}`, MakeString("four"))
+}
+
+func TestIfExprWithMultiTarget(t *testing.T) {
+	for _, i := range []int{11, 12, 13} {
+		expectProgramToReturn(t, fmt.Sprintf(`if %d {
+			10 -> :wrong
+			11, 5 + 7, { 10 + 3 } -> :right
+			_ -> :wrong2
+		}`, i), AtomValue("right"))
+	}
+}
+
+func TestNestedIfExpr(t *testing.T) {
+	expectProgramToReturn(t, `if 3 {
+		10, if true {
+			true -> 10
+			_ -> 3
+		} -> 'hi'
+		100, 3 -> 'hello'
+	}`, MakeString("hello"))
+}
+
+func TestIfExprWithEmpty(t *testing.T) {
+	expectProgramToReturn(t, `if 10 + 2 {
+		12 -> 'twelve'
+		_ -> 'wrong'
+	}`, MakeString("twelve"))
+}
+
+func TestIfExprWithAssignmentCond(t *testing.T) {
+	expectProgramToReturn(t, `if x := 2 + 4 {
+		6 -> x * x
+		_ -> x
+	}`, IntValue(36))
+}
+
+func TestIfExprInFunction(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn even?(n) if n % 2 {
+		0 -> true
+		_ -> false
+	}
+	even?(100)
+	`, oakTrue)
+}
+
+func TestComplexIfExprTarget(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn double(n) 2 * n
+	fn xyz(n) if n {
+		1 + 2 -> :abc
+		2 * double(3) -> :xyz
+		_ -> false
+	}
+	[xyz(3), xyz(12), xyz(24)]
+	`, MakeList(
+		AtomValue("abc"),
+		AtomValue("xyz"),
+		oakFalse,
+	))
+}
+
+func TestBasicWithExpr(t *testing.T) {
+	expectProgramToReturn(t, `fn add(a, b) { a + b }, with add(10) 40`, IntValue(50))
+}
+
+func TestWithExprWithCallback(t *testing.T) {
+	expectProgramToReturn(t, `fn applyThrice(x, f) f(f(f(x))), with applyThrice(10) fn(n) n + 1`, IntValue(13))
+}
+
+func TestRecursiveFunction(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn times(n, f) {
+		fn sub(i) if i {
+			n -> ?
+			_ -> {
+				f(i)
+				sub(i + 1)
+			}
+		}
+		sub(0)
+	}
+
+	counter := 0
+	with times(10) fn(i) {
+		counter <- counter + i * 10
+	}
+	counter
+	`, IntValue(450))
+}
+
+func TestRecursiveFunctionOnList(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn each(list, f) {
+		fn sub(i) if i {
+			len(list) -> ?
+			_ -> {
+				f(list.(i))
+				sub(i + 1)
+			}
+		}
+		sub(0)
+	}
+
+	sum := 0
+	list := [1, 2, 3, 4, 5]
+	with each(list) fn(it) {
+		sum <- sum + it
+	}
+	sum
+	`, IntValue(15))
+}
+
+func TestCurriedFunctionDef(t *testing.T) {
+	expectProgramToReturn(t, `
+	addThree := fn(a) fn(b) fn(c) {
+		a + b + c
+	}
+
+	almost := addThree(15)(20)
+	almost(8)
+	`, IntValue(15+20+8))
+}
+
+// string ops
+
+func TestStringAccess(t *testing.T) {
+	expectProgramToReturn(t, `
+	s := 'Hello, World!'
+	[
+		s.0 + s.2
+		s.-2
+		s.15
+	]
+	`, MakeList(MakeString("Hl"), null, null))
+}
+
+func TestStringAssign(t *testing.T) {
+	expectProgramToReturn(t, `
+	s := {
+		payload: 'Magnolia'
+	}
+	t := s.payload
+	[s.payload.3 := 'pie', t]
+	`, MakeList(
+		MakeString("Magpieia"),
+		MakeString("Magpieia"),
+	))
+}
+
+func TestStringAppendByPush(t *testing.T) {
+	expectProgramToReturn(t, `
+	s := {
+		payload: 'Oak'
+	}
+	[s.payload << ' language', s.payload]
+	`, MakeList(
+		MakeString("Oak language"),
+		MakeString("Oak language"),
+	))
+}
+
+func TestStringAppendByAssign(t *testing.T) {
+	expectProgramToReturn(t, `
+	s := {
+		payload: 'Oak'
+	}
+	t := s.payload
+	[s.payload.(len(s.payload)) := ' language', s.payload]
+	`, MakeList(
+		MakeString("Oak language"),
+		MakeString("Oak language"),
+	))
+}
+
+// list ops
+
+func TestListAccess(t *testing.T) {
+	expectProgramToReturn(t, `
+	s := [1, 2, 3, 4, 5]
+	[
+		s.0 + s.3
+		s.-2
+		s.15
+	]
+	`, MakeList(IntValue(5), null, null))
+}
+
+func TestListAssign(t *testing.T) {
+	result := MakeList(
+		IntValue(1),
+		IntValue(2),
+		MakeString("three"),
+		IntValue(4),
+	)
+
+	expectProgramToReturn(t, `
+	s := {
+		numbers: [1, 2, 3, 4]
+	}
+	t := s.numbers
+	[s.numbers.2 := 'three', t]
+	`, MakeList(result, result))
+}
+
+func TestListAppendByPush(t *testing.T) {
+	result := MakeList(
+		IntValue(1),
+		IntValue(2),
+		IntValue(3),
+		IntValue(4),
+		IntValue(100),
+	)
+
+	expectProgramToReturn(t, `
+	s := {
+		numbers: [1, 2, 3, 4]
+	}
+	t := s.numbers
+	[s.numbers << 100, t]
+	`, MakeList(result, result))
+}
+
+func TestListAppendByAssign(t *testing.T) {
+	result := MakeList(
+		IntValue(1),
+		IntValue(2),
+		IntValue(3),
+		IntValue(4),
+		IntValue(100),
+	)
+
+	expectProgramToReturn(t, `
+	s := {
+		numbers: [1, 2, 3, 4]
+	}
+	[s.numbers.(len(s.numbers)) := 100, s.numbers]
+	`, MakeList(result, result))
+}
+
+// object ops
+
+func TestObjectAccess(t *testing.T) {
+	expectProgramToReturn(t, `
+	obj := {
+		a: 'ay'
+		b: 'bee'
+		c: ['see', {
+			d: 'd'
+		}]
+	}
+	[
+		obj.c.(1).:d
+		obj.c.(1).(:d)
+	]
+	`, MakeList(
+		MakeString("d"),
+		MakeString("d"),
+	))
+}
+
+func TestObjectAssign(t *testing.T) {
+	expectProgramToReturn(t, `
+	obj := {
+		a: 'ay'
+		b: 'bee'
+		c: ['see', {
+			d: 'd'
+		}]
+	}
+	[
+		obj.c.(1).:e := 'hello_e'
+		obj.c.(1).(:f) := 'hello_f'
+		obj.c
+	]
+	`, MakeList(
+		ObjectValue{
+			"d": MakeString("d"),
+			"e": MakeString("hello_e"),
+			"f": MakeString("hello_f"),
+		},
+		ObjectValue{
+			"d": MakeString("d"),
+			"e": MakeString("hello_e"),
+			"f": MakeString("hello_f"),
+		},
+		MakeList(MakeString("see"), ObjectValue{
+			"d": MakeString("d"),
+			"e": MakeString("hello_e"),
+			"f": MakeString("hello_f"),
+		}),
+	))
+}
+
+func TestObjectDelete(t *testing.T) {
+	expectProgramToReturn(t, `
+	obj := {
+		a: 'ay'
+		b: 'bee'
+		c: {
+			d: 'dee'
+			e: 'ee'
+		}
+	}
+	[
+		obj.nonexistent := _
+		obj.b := { 1, 2, _ }
+		obj
+		obj.c.d := _
+		obj.c
+	]
+	`, MakeList(
+		ObjectValue{
+			"a": MakeString("ay"),
+			"c": ObjectValue{
+				"e": MakeString("ee"),
+			},
+		},
+		ObjectValue{
+			"a": MakeString("ay"),
+			"c": ObjectValue{
+				"e": MakeString("ee"),
+			},
+		},
+		ObjectValue{
+			"a": MakeString("ay"),
+			"c": ObjectValue{
+				"e": MakeString("ee"),
+			},
+		},
+		ObjectValue{
+			"e": MakeString("ee"),
+		},
+		ObjectValue{
+			"e": MakeString("ee"),
+		},
+	))
+}
+
+func TestSinglePipe(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn append(a, b) a + b
+	'hello' |> append('world')
+	`, MakeString("helloworld"))
+}
+
+func TestMultiPipe(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn append(a, b) a + b
+	'hello' |> append('world') |> append('!')
+	`, MakeString("helloworld!"))
+}
+
+func TestComplexPipe(t *testing.T) {
+	expectProgramToReturn(t, `
+	lib := {
+		add1: fn(n) n + 1
+		double: fn(n) 2 * n
+	}
+	fn getAdder(env) { env.add1 }
+	100 |> lib.add1() |> lib.double() |> getAdder(lib)()
+	`, IntValue(203))
+}
+
+func TestPipeWithExpr(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn add(a, b) a + b
+	fn double(n) 2 * n
+	fn apply(x, f) f(x)
+
+	10 |> add(20) |> with apply() fn(n) n |> double() + 40
+	`, IntValue(100))
+}
+
+func TestExtraArgs(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn getExtra(a, b, c) {
+		[b, c]
+	}
+	getExtra(1, ?)
+	`, MakeList(null, null))
+}
+
+func TestRestArgs(t *testing.T) {
+	expectProgramToReturn(t, `
+	fn getRest(first, rest...) {
+		rest
+	}
+	getRest(1, 2, 3, 4, 5)
+	`, MakeList(
+		IntValue(2),
+		IntValue(3),
+		IntValue(4),
+		IntValue(5),
+	))
+}
+
+func TestRuntimeErrorExcerpt(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	_, err := ctx.EvalFile("errors.oak", strings.NewReader(`fn add(x) {
+	x + 'a'
+}
+add(1)`))
+	expected := `Runtime error [errors.oak:2:4]: Cannot + incompatible values 1, 'a'
+2 | 	x + 'a'
+  | 	~~^~~~~
+  in fn add [errors.oak:1:1]`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error:\n%s\ngot:\n%s", expected, err)
+	}
+}
+
+func TestRuntimeErrorWithoutPosition(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	goCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ctx.EvalContext(goCtx, strings.NewReader(`1 + 2`))
+	expected := "Runtime error: Evaluation canceled: context canceled"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error:\n%s\ngot:\n%v", expected, err)
+	}
+}
+
+func TestImportedParseError(t *testing.T) {
+	ctx := NewContext("/src")
+	ctx.LoadBuiltins()
+	ctx.SetFS(ReadOnlyFS(fstest.MapFS{
+		"src/bad.oak": {Data: []byte("x := (\n")},
+	}))
+
+	_, err := ctx.EvalFile("/src/main.oak", strings.NewReader(`bad := import('bad')`))
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected syntax error from imported module, got %v", err)
+	}
+	expected := `Parse error at [/src/bad.oak:1:7]: Unexpected end of input, expected an expression
+1 | x := (
+  |       ^`
+	if err.Error() != expected {
+		t.Errorf("Expected error:\n%s\ngot:\n%s", expected, err)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetMaxCallDepth(100)
+
+	_, err := ctx.Eval(strings.NewReader(`
+	fn deep(n) if n {
+		0 -> 0
+		_ -> 1 + deep(n - 1)
+	}
+	deep(200)
+	`))
+	runtimeErr, ok := err.(*RuntimeError)
+	if !ok {
+		t.Fatalf("Expected stack overflow runtime error, got %v", err)
+	}
+	if !strings.HasPrefix(runtimeErr.reason, "Stack overflow") {
+		t.Errorf("Expected stack overflow error, got %s", runtimeErr.reason)
+	}
+	if len(runtimeErr.stackTrace) != 99 {
+		t.Errorf("Expected stack trace of 99 calls, got %d", len(runtimeErr.stackTrace))
+	}
+}
+
+func TestTailCallsDoNotOverflow(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetMaxCallDepth(100)
+
+	val, err := ctx.Eval(strings.NewReader(`
+	fn count(n, acc) if n {
+		0 -> acc
+		_ -> count(n - 1, acc + 1)
+	}
+	count(1000, 0)
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	if !val.Eq(IntValue(1000)) {
+		t.Errorf("Expected 1000, got %s", val)
+	}
+}
+
+func TestEvalContextDeadline(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	goCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := ctx.EvalContext(goCtx, strings.NewReader(`
+	fn loop(n) loop(n + 1)
+	loop(0)
+	`))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded error, got %v", err)
+	}
+}
+
+func TestEvalContextTearsDownAsyncWork(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	goCtx, cancel := context.WithCancel(context.Background())
+	_, err := ctx.EvalContext(goCtx, strings.NewReader(`
+	wait(60, fn {
+		exit(1)
+	})
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+
+	cancel()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected pending timers to be torn down after cancellation")
+	}
+}
+
+func TestEvalAfterCanceledEvalContext(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	goCtx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err := ctx.EvalContext(goCtx, strings.NewReader(`
+	fn loop(n) loop(n + 1)
+	loop(0)
+	`))
+	cancel()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected deadline exceeded error, got %v", err)
+	}
+
+	val, err := ctx.Eval(strings.NewReader(`
+	done := ?
+	wait(0.01, fn() done <- :done)
+	1 + 2
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect evaluation after a canceled call to fail, got %s", err.Error())
+	}
+	if !val.Eq(IntValue(3)) {
+		t.Errorf("Expected 3, got %s", val)
+	}
+
+	ctx.Wait()
+	if done, _ := ctx.Get("done"); !done.Eq(AtomValue("done")) {
+		t.Errorf("Expected timers after a canceled call to fire, got %s", done)
+	}
+}
+
+func TestFuelLimit(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetFuel(1000)
+
+	_, err := ctx.Eval(strings.NewReader(`
+	fn loop(n) loop(n + 1)
+	loop(0)
+	`))
+	if !errors.Is(err, ErrOutOfFuel) {
+		t.Errorf("Expected out of fuel error, got %v", err)
+	}
+	if fuel, ok := ctx.Fuel(); !ok || fuel != 0 {
+		t.Errorf("Expected fuel to be used up, got %d", fuel)
+	}
+}
+
+func TestFuelRemaining(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	if _, ok := ctx.Fuel(); ok {
+		t.Errorf("Expected evaluation to be unmetered by default")
+	}
+	ctx.SetFuel(1000)
+
+	if _, err := ctx.Eval(strings.NewReader("1 + 2")); err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	short, _ := ctx.Fuel()
+	if short >= 1000 {
+		t.Errorf("Expected evaluation to consume fuel, got %d remaining", short)
+	}
+
+	if _, err := ctx.Eval(strings.NewReader("fn add(a, b) a + b, add(add(1, 2), add(3, 4))")); err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	long, _ := ctx.Fuel()
+	if short-long <= 1000-short {
+		t.Errorf("Expected a longer program to consume more fuel")
+	}
+}
+
+func TestFuelLimitAppliesToCallbacks(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetFuel(1000)
+
+	var asyncErr error
+	ctx.eng.reportErr = func(err error) {
+		asyncErr = err
+	}
+	_, err := ctx.Eval(strings.NewReader(`
+	wait(0, fn {
+		fn loop(n) loop(n + 1)
+		loop(0)
+	})
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	if !errors.Is(asyncErr, ErrOutOfFuel) {
+		t.Errorf("Expected out of fuel error in callback, got %v", asyncErr)
+	}
+}
+
+func TestFuelLimitEndsEngine(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetFuel(200)
+
+	var asyncErrs []error
+	ctx.eng.reportErr = func(err error) {
+		asyncErrs = append(asyncErrs, err)
+	}
+	_, err := ctx.Eval(strings.NewReader(`
+	ticker(1, fn {
+		fn loop(n) loop(n + 1)
+		loop(0)
+	})
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected Wait to return after running out of fuel")
+	}
+
+	if len(asyncErrs) != 1 || !errors.Is(asyncErrs[0], ErrOutOfFuel) {
+		t.Errorf("Expected a single out of fuel error, got %v", asyncErrs)
+	}
+	if _, ok := ctx.ExitStatus(); ok {
+		t.Errorf("Did not expect running out of fuel to set an exit status")
+	}
+}
+
+func evalWithPolicy(t *testing.T, rootPath string, policy Policy, program string) Value {
+	ctx := NewContextWithPolicy(rootPath, policy)
+	ctx.LoadBuiltins()
+
+	val, err := ctx.Eval(strings.NewReader(program))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	return val
+}
+
+func TestPolicyDeniesCapabilities(t *testing.T) {
+	val := evalWithPolicy(t, "/tmp", Policy{}, `[
+		exec('echo', [], '').type
+		exit(1).type
+		listen('0.0.0.0:9999', fn {}).type
+		req({ url: 'http://localhost:9999' }).type
+		ls('/tmp').type
+		stat('/tmp').type
+		signal('SIGINT', fn {}).type
+		spawn('echo', [], fn {}).type
+		tcpListen('127.0.0.1:0', fn {}).type
+		tcpDial('127.0.0.1:9999', fn {}).type
+		udpListen('127.0.0.1:0', fn {}).type
+	]`)
+	expected := MakeList(
+		AtomValue("error"), AtomValue("error"), AtomValue("error"),
+		AtomValue("error"), AtomValue("error"), AtomValue("error"),
+		AtomValue("error"), AtomValue("error"), AtomValue("error"),
+		AtomValue("error"), AtomValue("error"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected denied calls to return errors, got %s", val)
+	}
+}
+
+func TestPolicyReadOnlyFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	val := evalWithPolicy(t, dir, Policy{FS: FSReadOnly}, fmt.Sprintf(`[
+		stat('%s').type
+		open('%s', :readonly).type
+		open('%s', :readwrite).type
+		mkdir('%s').type
+		rm('%s').type
+	]`,
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(dir, "b"),
+		filepath.Join(dir, "a.txt"),
+	))
+	expected := MakeList(
+		AtomValue("data"), AtomValue("file"), AtomValue("error"),
+		AtomValue("error"), AtomValue("error"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected only reads to be permitted, got %s", val)
+	}
+}
+
+func TestPolicyFSRoots(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	val := evalWithPolicy(t, root, Policy{FS: FSReadWrite, FSRoots: []string{root}}, fmt.Sprintf(`[
+		mkdir('%s').type
+		ls('%s').type
+		ls('%s').type
+		mkdir('%s').type
+	]`,
+		filepath.Join(root, "a", "b"),
+		filepath.Join(root, "a", "..", ".."),
+		outside,
+		filepath.Join(root, "escape", "c"),
+	))
+	expected := MakeList(
+		AtomValue("end"), AtomValue("error"), AtomValue("error"), AtomValue("error"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected access outside of roots to be denied, got %s", val)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "c")); err == nil {
+		t.Errorf("Expected symlinked directory outside of roots to be untouched")
+	}
+}
+
+func TestPolicyFSRootsInEngineFS(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"allowed", "other"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "a.txt"), []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join("..", "other"), filepath.Join(dir, "allowed", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := Policy{FS: FSReadOnly, FSRoots: []string{"/allowed"}}
+	for _, tc := range []struct {
+		name string
+		fsys FS
+	}{
+		{"DirFS", DirFS(dir)},
+		{"ReadOnlyFS", ReadOnlyFS(fstest.MapFS{
+			"allowed/a.txt": {Data: []byte("a")},
+			"other/a.txt":   {Data: []byte("a")},
+		})},
+	} {
+		ctx := NewContextWithPolicy("/", policy)
+		ctx.LoadBuiltins()
+		ctx.SetFS(tc.fsys)
+
+		val, err := ctx.Eval(strings.NewReader(`[
+			stat('/allowed/a.txt').type
+			stat('allowed/a.txt').type
+			stat('/other/a.txt').type
+			stat('/allowed/../other/a.txt').type
+		]`))
+		if err != nil {
+			t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+		}
+		expected := MakeList(
+			AtomValue("data"), AtomValue("data"), AtomValue("error"), AtomValue("error"),
+		)
+		if !val.Eq(expected) {
+			t.Errorf("Expected roots to apply to paths in %s, got %s", tc.name, val)
+		}
+	}
+
+	ctx := NewContextWithPolicy("/", policy)
+	ctx.LoadBuiltins()
+	ctx.SetFS(DirFS(dir))
+	val, err := ctx.Eval(strings.NewReader(`stat('/allowed/link/a.txt').type`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	if !val.Eq(AtomValue("error")) {
+		t.Errorf("Expected link out of roots in DirFS to be denied, got %s", val)
+	}
+}
+
+func TestPolicyAppliesToImports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mod.oak"), []byte(`
+	std := import('std')
+	result := exec('echo', [], '').type
+	`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	val := evalWithPolicy(t, dir, Policy{FS: FSReadOnly, FSRoots: []string{dir}}, `import('mod').result`)
+	if !val.Eq(AtomValue("error")) {
+		t.Errorf("Expected imported module to be denied exec, got %s", val)
+	}
+
+	ctx := NewContextWithPolicy(dir, Policy{})
+	ctx.LoadBuiltins()
+	if _, err := ctx.Eval(strings.NewReader(`import('mod')`)); err == nil {
+		t.Errorf("Expected import to be denied without filesystem access")
+	}
+}
+
+func TestBuiltinReturningNil(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.LoadFunc("nothing", func(_ []Value) (Value, *RuntimeError) {
+		return nil, nil
+	})
+
+	val, err := ctx.Eval(strings.NewReader(`
+	fn tail nothing()
+	fn add(a, b) a + b
+	[nothing(), tail(), add(1, 2), nothing() = ?]
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(null, null, IntValue(3), oakTrue)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+}
+
+func TestEmbeddingAPI(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.Set("base", MakeInt(10))
+	ctx.LoadFunc("double", func(args []Value) (Value, *RuntimeError) {
+		n, ok := args[0].(IntValue)
+		if !ok {
+			return nil, NewRuntimeError("double() expects an int")
+		}
+		return MakeInt(int64(n) * 2), nil
+	})
+
+	if _, err := ctx.Eval(strings.NewReader(`fn addBase(n) double(n) + base`)); err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	addBase, ok := ctx.Get("addBase")
+	if !ok {
+		t.Fatalf("Expected addBase to be defined")
+	}
+
+	val, err := ctx.Call(addBase, MakeInt(3))
+	if err != nil {
+		t.Fatalf("Did not expect call to fail: %s", err.Error())
+	}
+	if !val.Eq(MakeInt(16)) {
+		t.Errorf("Expected 16, got %s", val)
+	}
+
+	if _, err := ctx.Call(addBase, MakeString("3")); err == nil {
+		t.Errorf("Expected call with a string to fail")
+	}
+
+	sub := ctx.SubContext()
+	if _, err := sub.Eval(strings.NewReader(`local := addBase(1)`)); err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	if _, ok := ctx.Get("local"); ok {
+		t.Errorf("Expected definitions in a sub-context not to leak")
+	}
+}
+
+func TestRegisteredModule(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "user.oak"), []byte(`
+	company := import('company')
+	greeting := company.greet('Linus')
+	`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContext(dir)
+	ctx.LoadBuiltins()
+
+	loads := 0
+	lookup, err := Bind("lookup", func(id int) string {
+		return fmt.Sprintf("employee #%d", id)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.RegisterModule("company", Module{
+		Members: map[string]Value{
+			"lookup": lookup,
+			"loaded": MakeBuiltinFn("loaded", func(_ []Value) (Value, *RuntimeError) {
+				loads++
+				return null, nil
+			}),
+			"Name": MakeString("Acme"),
+		},
+		Source: `
+		loaded()
+		fn greet(name) 'Hello, ' + name + ' from ' + Name
+		`,
+	})
+	ctx.RegisterModule("std", Module{
+		Members: map[string]Value{"custom?": oakTrue},
+	})
+
+	val, err := ctx.Eval(strings.NewReader(`
+	company := import('company')
+	user := import('user')
+	[company.lookup(3), user.greeting, import('std').'custom?']
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(
+		MakeString("employee #3"),
+		MakeString("Hello, Linus from Acme"),
+		oakTrue,
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+	if loads != 1 {
+		t.Errorf("Expected module to be loaded once, got %d loads", loads)
+	}
+}
+
+func TestStdioRedirection(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mod.oak"), []byte(`print('from module\n')`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	var reported []error
+	ctx := NewContext(dir)
+	ctx.LoadBuiltins()
+	ctx.SetStdin(strings.NewReader("first line\nsecond"))
+	ctx.SetStdout(&stdout)
+	ctx.SetErrorReporter(func(err error) {
+		reported = append(reported, err)
+	})
+
+	val, err := ctx.Eval(strings.NewReader(`
+	import('mod')
+	print(input().data + '\n')
+	wait(0, fn {
+		print(input().data + '\n')
+		undefinedVar
+	})
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	if !val.Eq(null) {
+		t.Errorf("Expected ?, got %s", val)
+	}
+	if stdout.String() != "from module\nfirst line\nsecond\n" {
+		t.Errorf("Got unexpected output %q", stdout.String())
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "undefinedVar is undefined") {
+		t.Errorf("Expected undefined variable error to be reported, got %v", reported)
+	}
+}
+
+func TestReportErrorToStderr(t *testing.T) {
+	var stderr bytes.Buffer
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetStderr(&stderr)
+
+	_, err := ctx.Eval(strings.NewReader(`
+	wait(0, fn { asyncVar })
+	syncVar
+	`))
+	if err == nil {
+		t.Fatalf("Expected program to exit with error")
+	}
+	ctx.ReportError(err)
+	ctx.Wait()
+
+	output := stderr.String()
+	if !strings.Contains(output, "syncVar is undefined") || !strings.Contains(output, "asyncVar is undefined") {
+		t.Errorf("Expected errors to be reported to stderr, got %q", output)
+	}
+}
+
+func TestReadOnlyFS(t *testing.T) {
+	ctx := NewContext("/src")
+	ctx.LoadBuiltins()
+	ctx.SetFS(ReadOnlyFS(fstest.MapFS{
+		"src/greet.oak": {Data: []byte(`fn greet(name) 'Hello, ' + name`)},
+		"data/name.txt": {Data: []byte("Linus")},
+	}))
+
+	val, err := ctx.Eval(strings.NewReader(`
+	greet := import('greet').greet
+	file := open('/data/name.txt', :readonly)
+	name := read(file.fd, 0, 100).data
+	close(file.fd)
+	[
+		greet(name)
+		stat('data/name.txt').data.len
+		stat('/missing.txt').data
+		ls('/').data |> len()
+		mkdir('/new').type
+		open('/data/name.txt').type
+	]
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(
+		MakeString("Hello, Linus"),
+		IntValue(5),
+		null,
+		IntValue(2),
+		AtomValue("error"),
+		AtomValue("error"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+}
+
+func TestMemFS(t *testing.T) {
+	ctx := NewContext("/src")
+	ctx.LoadBuiltins()
+	ctx.SetFS(MemFS())
+
+	val, err := ctx.Eval(strings.NewReader(`
+	mkdir('/src/lib')
+	file := open('/src/lib/greet.oak', :truncate)
+	write(file.fd, 0, 'fn greet(name) \'Hello, \' + name')
+	close(file.fd)
+	greet := import('lib/greet').greet
+
+	file := open('/data.txt', :append)
+	write(file.fd, -1, 'Li')
+	write(file.fd, -1, 'nus')
+	close(file.fd)
+	file := open('/data.txt', :readonly)
+	name := read(file.fd, 0, 100).data
+	close(file.fd)
+
+	[
+		greet(name)
+		copy('/data.txt', '/copy.txt').type
+		copy('/copy.txt', 'copy.txt').type
+		rename('/copy.txt', '/src/moved.txt').type
+		chmod('/src/moved.txt', 384).type
+		stat('/src/moved.txt').data.perm
+		stat('/src/moved.txt').data.len
+		stat('/copy.txt').data
+		ls('/src').data |> len()
+		rm('/src').type
+		ls('/').data |> len()
+		open('/missing/file.txt', :truncate).type
+	]
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(
+		MakeString("Hello, Linus"),
+		AtomValue("end"),
+		AtomValue("error"),
+		AtomValue("end"),
+		AtomValue("end"),
+		IntValue(0600),
+		IntValue(5),
+		null,
+		IntValue(2),
+		AtomValue("end"),
+		IntValue(1),
+		AtomValue("error"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+}
+
+func TestFileDescriptorsAcrossFS(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := NewContext(dir)
+	ctx.LoadBuiltins()
+	open := func(fsys FS, name string) {
+		ctx.SetFS(fsys)
+		if _, err := ctx.Eval(strings.NewReader(fmt.Sprintf(`files << open('%s', :readonly).fd`, name))); err != nil {
+			t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+		}
+	}
+
+	ctx.Set("files", MakeList())
+	open(OSFS(), filepath.Join(dir, "a.txt"))
+	open(ReadOnlyFS(fstest.MapFS{"b.txt": {Data: []byte("b.txt")}}), "/b.txt")
+	open(OSFS(), filepath.Join(dir, "c.txt"))
+
+	val, err := ctx.Eval(strings.NewReader(`[read(files.0, 0, 10).data, read(files.1, 0, 10).data, read(files.2, 0, 10).data]`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(MakeString("a.txt"), MakeString("b.txt"), MakeString("c.txt"))
+	if !val.Eq(expected) {
+		t.Errorf("Expected each file to keep its own fd, got %s", val)
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	dir := t.TempDir()
+	ctx := NewContext("/")
+	ctx.LoadBuiltins()
+	ctx.SetFS(DirFS(dir))
+
+	_, err := ctx.Eval(strings.NewReader(`
+	mkdir('/a')
+	file := open('../../a/b.txt', :truncate)
+	write(file.fd, 0, 'jailed')
+	close(file.fd)
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "a", "b.txt"))
+	if err != nil || string(data) != "jailed" {
+		t.Errorf("Expected file to be written within directory, got %q, %v", data, err)
+	}
+}
+
+func TestExitEndsOnlyInterpreter(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	_, err := ctx.Eval(strings.NewReader(`
+	wait(60, fn {
+		print('should not run')
+	})
+	exit(3)
+	print('should not run either')
+	`))
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Fatalf("Expected exit error with status 3, got %v", err)
+	}
+	if code, ok := ctx.ExitStatus(); !ok || code != 3 {
+		t.Errorf("Expected exit status 3, got %d, %v", code, ok)
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected pending timers to be torn down after exit")
+	}
+
+	if _, err := ctx.Eval(strings.NewReader(`1 + 2`)); !errors.As(err, &exitErr) {
+		t.Errorf("Expected evaluation after exit to fail, got %v", err)
+	}
+}
+
+func TestExitFromCallback(t *testing.T) {
+	var stdout bytes.Buffer
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetStdout(&stdout)
+
+	_, err := ctx.Eval(strings.NewReader(`
+	wait(0, fn {
+		print('exiting')
+		exit(2)
+	})
+	wait(60, fn {
+		print('should not run')
+	})
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	if code, ok := ctx.ExitStatus(); !ok || code != 2 {
+		t.Errorf("Expected exit status 2, got %d, %v", code, ok)
+	}
+	if stdout.String() != "exiting" {
+		t.Errorf("Got unexpected output %q", stdout.String())
+	}
+}
+
+func TestExitWhileReadingStdin(t *testing.T) {
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetStdin(stdin)
+
+	_, err := ctx.Eval(strings.NewReader(`
+	input(fn(evt) print('should not run'))
+	wait(0, fn { exit(4) })
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected Wait to return after exit while reading stdin")
+	}
+	if code, ok := ctx.ExitStatus(); !ok || code != 4 {
+		t.Errorf("Expected exit status 4, got %d, %v", code, ok)
+	}
+}
+
+func TestRandSource(t *testing.T) {
+	randoms := func() Value {
+		ctx := NewContext("/tmp")
+		ctx.LoadBuiltins()
+		ctx.SetRandSource(rand.NewSource(42))
+		val, err := ctx.Eval(strings.NewReader(`[rand(), rand(), rand()]`))
+		if err != nil {
+			t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+		}
+		return val
+	}
+
+	if first, second := randoms(), randoms(); !first.Eq(second) {
+		t.Errorf("Expected the same source to produce the same numbers, got %s and %s", first, second)
+	}
+}
+
+func TestConcurrentInterpreters(t *testing.T) {
+	const interpreters = 8
+
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, interpreters)
+	statuses := make([]int, interpreters)
+	for i := 0; i < interpreters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ctx := NewContext("/tmp")
+			ctx.LoadBuiltins()
+			ctx.SetStdout(&outputs[i])
+			ctx.SetStdin(strings.NewReader(fmt.Sprintf("input %d\n", i)))
+			ctx.Set("id", MakeInt(int64(i)))
+
+			ctx.Eval(strings.NewReader(`
+			std := import('std')
+			wait(0.01, fn {
+				std.println(input().data, rand() < 1)
+				exit(id)
+			})
+			`))
+			ctx.Wait()
+			statuses[i], _ = ctx.ExitStatus()
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < interpreters; i++ {
+		if expected := fmt.Sprintf("input %d true\n", i); outputs[i].String() != expected {
+			t.Errorf("Expected interpreter %d to print %q, got %q", i, expected, outputs[i].String())
+		}
+		if statuses[i] != i {
+			t.Errorf("Expected interpreter %d to exit with status %d, got %d", i, i, statuses[i])
+		}
+	}
+}
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetVirtualClock(NewVirtualClock(start))
+
+	realStart := time.Now()
+	_, err := ctx.Eval(strings.NewReader(`
+	log := []
+	start := time()
+	fn record(name) log << [name, time() - start]
+
+	wait(3600, fn() record(:hour))
+	wait(1, fn {
+		record(:first)
+		wait(2, fn() record(:nested))
+	})
+	wait(1, fn() record(:second))
+	wait(0.5)
+	record(:slept)
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	if elapsed := time.Since(realStart); elapsed > 5*time.Second {
+		t.Errorf("Expected virtual timers to run without waiting, took %s", elapsed)
+	}
+
+	log, _ := ctx.Get("log")
+	expected := MakeList(
+		MakeList(AtomValue("slept"), FloatValue(0.5)),
+		MakeList(AtomValue("first"), FloatValue(1)),
+		MakeList(AtomValue("second"), FloatValue(1)),
+		MakeList(AtomValue("nested"), FloatValue(3)),
+		MakeList(AtomValue("hour"), FloatValue(3600)),
+	)
+	if !log.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, log)
+	}
+}
+
+func TestTimersAndTickers(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	_, err := ctx.Eval(strings.NewReader(`
+	ticks := 0
+	fired := []
+	never := timer(60, fn() fired << :never)
+	t := ticker(0.01, fn {
+		ticks <- ticks + 1
+		if ticks = 3 -> {
+			fired << t.cancel()
+			fired << never.cancel()
+			fired << never.cancel()
+		}
+	})
+	timer(0, fn() fired << :soon)
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected cancelled timers not to keep the program running")
+	}
+
+	ticks, _ := ctx.Get("ticks")
+	fired, _ := ctx.Get("fired")
+	if !ticks.Eq(IntValue(3)) {
+		t.Errorf("Expected 3 ticks, got %s", ticks)
+	}
+	expected := MakeList(AtomValue("soon"), oakTrue, oakTrue, oakFalse)
+	if !fired.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, fired)
+	}
+}
+
+func TestVirtualTickers(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	ctx.SetVirtualClock(NewVirtualClock(time.Unix(0, 0)))
+
+	_, err := ctx.Eval(strings.NewReader(`
+	log := []
+	t := ticker(2, fn {
+		log << [:tick, time()]
+		if len(log) >= 4 -> t.cancel()
+	})
+	timer(3, fn() log << [:timer, time()])
+	timer(100, fn() log << [:late, time()]).cancel()
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	log, _ := ctx.Get("log")
+	expected := MakeList(
+		MakeList(AtomValue("tick"), FloatValue(2)),
+		MakeList(AtomValue("timer"), FloatValue(3)),
+		MakeList(AtomValue("tick"), FloatValue(4)),
+		MakeList(AtomValue("tick"), FloatValue(6)),
+	)
+	if !log.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, log)
+	}
+}
+
+func TestAsyncErrorModes(t *testing.T) {
+	program := `
+	log := []
+	onerror(fn(evt) log << evt.type)
+	wait(0.01, fn {
+		log << :first
+		1 + :a
+	})
+	wait(0.05, fn {
+		log << :second
+		1 + :b
+	})
+	`
+	for _, test := range []struct {
+		mode     AsyncErrorMode
+		reported int
+		counted  int
+		log      Value
+		exited   bool
+	}{
+		{AsyncErrorPrint, 2, 2, MakeList(AtomValue("first"), AtomValue("second")), false},
+		{AsyncErrorExit, 1, 1, MakeList(AtomValue("first")), true},
+		{AsyncErrorHandle, 0, 2, MakeList(AtomValue("first"), AtomValue("error"), AtomValue("second"), AtomValue("error")), false},
+	} {
+		ctx := NewContext("/tmp")
+		ctx.LoadBuiltins()
+		ctx.SetAsyncErrorMode(test.mode)
+
+		reported := 0
+		ctx.SetErrorReporter(func(err error) {
+			reported++
+		})
+		if _, err := ctx.Eval(strings.NewReader(program)); err != nil {
+			t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+		}
+		ctx.Wait()
+
+		if reported != test.reported {
+			t.Errorf("In mode %s, expected %d errors reported, got %d", test.mode, test.reported, reported)
+		}
+		if log, _ := ctx.Get("log"); !log.Eq(test.log) {
+			t.Errorf("In mode %s, expected %s, got %s", test.mode, test.log, log)
+		}
+		if code, exited := ctx.ExitStatus(); exited != test.exited || (exited && code != 1) {
+			t.Errorf("In mode %s, got unexpected exit status %d", test.mode, code)
+		}
+		if ctx.AsyncErrors() != test.counted {
+			t.Errorf("In mode %s, expected %d async errors, got %d", test.mode, test.counted, ctx.AsyncErrors())
+		}
+	}
+
+	if _, err := ParseAsyncErrorMode("bogus"); err == nil {
+		t.Errorf("Expected unknown async error mode not to parse")
+	}
+}
+
+func TestFileManagementBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	ctx := NewContext(dir)
+	ctx.LoadBuiltins()
+
+	val, err := ctx.Eval(strings.NewReader(fmt.Sprintf(`
+	dir := '%s'
+	file := open(dir + '/a.txt', :truncate)
+	write(file.fd, 0, 'hello')
+	close(file.fd)
+	mkdir(dir + '/sub')
+
+	[
+		copy(dir + '/a.txt', dir + '/b.txt').type
+		chmod(dir + '/b.txt', 384).type
+		stat(dir + '/b.txt').data.perm
+		rename(dir + '/b.txt', dir + '/sub/c.txt').type
+		stat(dir + '/b.txt').data
+		symlink('../a.txt', dir + '/sub/link').type
+		readlink(dir + '/sub/link').data
+		lstat(dir + '/sub/link').data.symlink
+		stat(dir + '/sub/link').data.len
+		readlink(dir + '/a.txt').type
+		copy(dir + '/sub', dir + '/d').type
+		copy(dir + '/a.txt', dir + '/a.txt').type
+		copy(dir + '/a.txt', dir + '/sub/link').type
+		stat(dir + '/a.txt').data.len
+	]
+	`, dir)))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(
+		AtomValue("end"), AtomValue("end"), IntValue(0600),
+		AtomValue("end"), null,
+		AtomValue("end"), MakeString("../a.txt"), oakTrue, IntValue(5),
+		AtomValue("error"), AtomValue("error"),
+		AtomValue("error"), AtomValue("error"), IntValue(5),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+
+	val, err = ctx.Eval(strings.NewReader(fmt.Sprintf(`
+	files := walk('%s').data
+	fn sub(paths, i) if i {
+		len(files) -> paths
+		_ -> sub(paths << files.(i).path, i + 1)
+	}
+	sub([], 0)
+	`, dir)))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected = MakeList(
+		MakeString(dir+"/a.txt"),
+		MakeString(dir+"/sub"),
+		MakeString(dir+"/sub/c.txt"),
+		MakeString(dir+"/sub/link"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+}
+
+func TestDirFSSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	ctx := NewContext("/")
+	ctx.LoadBuiltins()
+	ctx.SetFS(DirFS(dir))
+
+	val, err := ctx.Eval(strings.NewReader(`
+	mkdir('/a')
+	[
+		symlink('/a', '/a/abs').type
+		readlink('/a/abs').data
+		symlink('../../outside', '/a/rel').type
+	]
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(AtomValue("end"), MakeString("."), AtomValue("error"))
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+
+	if target, err := os.Readlink(filepath.Join(dir, "a", "abs")); err != nil || target != "." {
+		t.Errorf("Expected absolute link to point within directory, got %q, %v", target, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	ctx := NewContext(dir)
+	ctx.LoadBuiltins()
+
+	_, err := ctx.Eval(strings.NewReader(fmt.Sprintf(`
+	events := []
+	watcher := watch('%s', { recursive: true, interval: 0.01 }, fn(evt) events << evt)
+	`, dir)))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	waitForEvents := func(n int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if done, _ := ctx.Eval(strings.NewReader(fmt.Sprintf(`len(events) >= %d`, n))); done.Eq(oakTrue) {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("Timed out waiting for %d watch events", n)
+	}
+	file := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	if err := os.WriteFile(file("a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvents(1)
+	if err := os.MkdirAll(file("sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file("sub/b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvents(3)
+	if err := os.WriteFile(file("a.txt"), []byte("aa"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvents(4)
+	if err := os.Rename(file("a.txt"), file("sub/c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvents(5)
+	if err := os.Remove(file("sub/b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvents(6)
+
+	if _, err := ctx.Eval(strings.NewReader(`watcher.cancel()`)); err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	event := func(evtType, name string) ObjectValue {
+		return ObjectValue{"type": AtomValue(evtType), "path": MakeString(file(name))}
+	}
+	renamed := event("rename", "sub/c.txt")
+	renamed["from"] = MakeString(file("a.txt"))
+	expected := MakeList(
+		event("create", "a.txt"),
+		event("create", "sub"),
+		event("create", "sub/b.txt"),
+		event("modify", "a.txt"),
+		renamed,
+		event("delete", "sub/b.txt"),
+	)
+	if events, _ := ctx.Get("events"); !events.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, events)
+	}
+}
+
+func TestWatchKeepsItsFS(t *testing.T) {
+	dir := t.TempDir()
+	ctx := NewContext(dir)
+	ctx.LoadBuiltins()
+
+	_, err := ctx.Eval(strings.NewReader(fmt.Sprintf(`
+	created := ?
+	watcher := watch('%s', { interval: 0.01 }, fn(evt) {
+		created <- evt.path
+		watcher.cancel()
+	})
+	`, dir)))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	// the watch started on the OS filesystem, so it still sees changes there
+	ctx.SetFS(ReadOnlyFS(fstest.MapFS{}))
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for watch event")
+	}
+	if created, _ := ctx.Get("created"); !created.Eq(MakeString(filepath.Join(dir, "a.txt"))) {
+		t.Errorf("Expected watch to report the new file, got %s", created)
+	}
+}
+
+func TestStreamingReads(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("line1\nline2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := NewContext(dir)
+	ctx.LoadBuiltins()
+	ctx.SetStdin(strings.NewReader("ab\x00cd\nline\nrest"))
+
+	val, err := ctx.Eval(strings.NewReader(fmt.Sprintf(`
+	file := open('%s', :readonly)
+	[
+		read(0, ?, 2).data
+		read(0, ?, '\n').data
+		input().data
+		read(0, ?, 10).data
+		read(0, ?, 1).type
+		read(file.fd, ?, '\n').data
+		read(file.fd, 0, 3).data
+		read(file.fd, ?, 2).data
+		read(file.fd, ?, '\n').data
+		read(file.fd, ?, '\n').data
+		read(file.fd, ?, '\n').type
+		read(file.fd, ?, 4).type
+	]
+	`, filepath.Join(dir, "a.txt"))))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(
+		MakeString("ab"),
+		MakeString("\x00cd\n"),
+		MakeString("line"),
+		MakeString("rest"),
+		AtomValue("eof"),
+		MakeString("line1\n"),
+		MakeString("lin"),
+		MakeString("e1"),
+		MakeString("\n"),
+		MakeString("line2"),
+		AtomValue("eof"),
+		AtomValue("eof"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+
+	_, err = ctx.Eval(strings.NewReader(`read(0, ?, '\r\n')`))
+	if err == nil || !strings.Contains(err.Error(), "single-byte delimiter") {
+		t.Errorf("Expected delimiter error, got %v", err)
+	}
+}
+
+func TestTCPSockets(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	_, err := ctx.Eval(strings.NewReader(`
+	log := []
+	serverLog := []
+	server := tcpListen('127.0.0.1:0', fn(evt) if evt.type {
+		:data -> evt.conn.write('echo: ' + evt.data)
+		:end -> {
+			serverLog << :end
+			evt.conn.close()
+			server.close()
+		}
+	})
+	tcpDial(server.addr, fn(evt) if evt.type {
+		:connect -> {
+			log << [:remote, evt.conn.remote = server.addr]
+			evt.conn.write('hello')
+		}
+		:data -> {
+			log << evt.data
+			evt.conn.close()
+		}
+		:end -> log << :client_end
+		_ -> log << evt
+	})
+	dialErr := ?
+	tcpDial('127.0.0.1:1', fn(evt) dialErr <- evt.type)
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected closed sockets not to keep the program running")
+	}
+
+	log, _ := ctx.Get("log")
+	expected := MakeList(
+		MakeList(AtomValue("remote"), oakTrue),
+		MakeString("echo: hello"),
+		AtomValue("client_end"),
+	)
+	if !log.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, log)
+	}
+	if serverLog, _ := ctx.Get("serverLog"); !serverLog.Eq(MakeList(AtomValue("end"))) {
+		t.Errorf("Expected server to see the connection end, got %s", serverLog)
+	}
+	if dialErr, _ := ctx.Get("dialErr"); !dialErr.Eq(AtomValue("error")) {
+		t.Errorf("Expected failed dial to report an error, got %s", dialErr)
+	}
+}
+
+func TestTCPConnClosesWhenPeerCloses(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	_, err := ctx.Eval(strings.NewReader(`
+	server := tcpListen('127.0.0.1:0', fn(evt) if evt.type {
+		:data -> evt.conn.write('echo: ' + evt.data)
+		:end -> server.close()
+	})
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	server, _ := ctx.Get("server")
+	addr := server.(ObjectValue)["addr"].(*StringValue).stringContent()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("hello"))
+	conn.(*net.TCPConn).CloseWrite()
+
+	// the server finishes its write and closes its side without the
+	// program closing the connection
+	received, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Expected server to close the connection, got %s", err.Error())
+	}
+	if string(received) != "echo: hello" {
+		t.Errorf("Got unexpected response %q", received)
+	}
+	ctx.Wait()
+}
+
+// failingWriteConn is a connection to which every write fails.
+type failingWriteConn struct {
+	net.Conn
+}
+
+func (failingWriteConn) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestConnWriteError(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	_, err := ctx.Eval(strings.NewReader(`
+	log := []
+	fn callback(evt) if evt.type {
+		:connect -> evt.conn.write('hello')
+		:error -> log << evt.error
+		_ -> log << evt.type
+	}
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	callback, _ := ctx.Get("callback")
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	ctx.startConn(failingWriteConn{local}, callback)
+	ctx.Wait()
+
+	log, _ := ctx.Get("log")
+	expected := MakeList(
+		MakeString("Error writing to connection: broken pipe"),
+		AtomValue("end"),
+	)
+	if !log.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, log)
+	}
+}
+
+func TestUDPSockets(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	_, err := ctx.Eval(strings.NewReader(`
+	log := []
+	server := udpListen('127.0.0.1:0', fn(evt) {
+		log << [:server, evt.data]
+		server.send(evt.from, 'pong')
+		server.close()
+	})
+	client := udpListen('127.0.0.1:0', fn(evt) {
+		log << [:client, evt.data]
+		client.close()
+	})
+	log << client.send(server.addr, 'ping').type
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	log, _ := ctx.Get("log")
+	expected := MakeList(
+		AtomValue("end"),
+		MakeList(AtomValue("server"), MakeString("ping")),
+		MakeList(AtomValue("client"), MakeString("pong")),
+	)
+	if !log.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, log)
+	}
+}
+
+func TestUnixSocketHTTP(t *testing.T) {
+	// Unix socket paths are short, so avoid the long paths of t.TempDir()
+	dir, err := os.MkdirTemp("", "oak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sockPath := filepath.Join(dir, "http.sock")
+
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	_, err = ctx.Eval(strings.NewReader(fmt.Sprintf(`
+	resp := ?
+	close := listen('unix:%s', fn(evt) if evt.type {
+		:req -> evt.end({
+			status: 200
+			headers: {}
+			body: 'hello from ' + evt.req.url
+		})
+		_ -> resp <- evt
+	})
+	wait(0.1, fn {
+		req({ url: 'http://oak/greet', socket: '%s' }, fn(evt) {
+			resp <- evt
+			close()
+		})
+	})
+	`, sockPath, sockPath)))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected closed server not to keep the program running")
+	}
+
+	resp, _ := ctx.Get("resp")
+	respObj, ok := resp.(ObjectValue)
+	if !ok || respObj["type"] != AtomValue("resp") {
+		t.Fatalf("Expected a response event, got %s", resp)
+	}
+	body := respObj["resp"].(ObjectValue)["body"]
+	if !body.Eq(MakeString("hello from /greet")) {
+		t.Errorf("Expected response body from server, got %s", body)
+	}
+	if _, err := os.Stat(sockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected socket file to be removed on close, got %v", err)
+	}
+}
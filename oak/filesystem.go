@@ -0,0 +1,263 @@
+package oak
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FS is a filesystem that file builtins and imports of Oak source files use.
+// It extends io/fs with the operations builtins need to write files.
+//
+// Unlike in io/fs, names are paths as Oak programs write them, which may be
+// absolute or relative, and are interpreted by each implementation.
+//
+// OSFS, DirFS, ReadOnlyFS, and the in-memory MemFS implement FS.
+type FS interface {
+	fs.StatFS
+	fs.ReadDirFS
+	// OpenFile opens a file with flags and permissions as in os.OpenFile.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	MkdirAll(name string, perm fs.FileMode) error
+	RemoveAll(name string) error
+}
+
+// RenameFS is an FS that can move files, which rename() requires.
+type RenameFS interface {
+	FS
+	Rename(oldname, newname string) error
+}
+
+// ChmodFS is an FS that can change file permissions, which chmod() requires.
+type ChmodFS interface {
+	FS
+	Chmod(name string, mode fs.FileMode) error
+}
+
+// SymlinkFS is an FS with symbolic links, which symlink() and readlink()
+// require. Without one, lstat() is the same as stat().
+type SymlinkFS interface {
+	FS
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+var errNotSupported = errors.New("not supported by this file system")
+
+// File is a file opened by an FS. *os.File implements File.
+type File interface {
+	fs.File
+	io.Seeker
+	io.Writer
+}
+
+// SetFS sets the filesystem used by programs in this Context, and every
+// Context sharing its engine, which is the OS filesystem by default.
+func (c *Context) SetFS(fsys FS) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.fs = fsys
+}
+
+// OSFS returns the filesystem of the host operating system, in which relative
+// paths are relative to the working directory of the process.
+func OSFS() FS {
+	return osFS{}
+}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (osFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (osFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (osFS) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (osFS) Symlink(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (osFS) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (osFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+// DirFS returns a filesystem of the files under dir in the OS filesystem.
+// Both absolute and relative paths are resolved within dir, so that programs
+// cannot refer to files outside of it by name. Symbolic links within dir are
+// followed as usual, so a Policy with FSRoots, which are paths within dir like
+// "/", should also be used if dir may contain links that lead outside of it.
+func DirFS(dir string) FS {
+	return dirFS(dir)
+}
+
+type dirFS string
+
+func (d dirFS) join(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(path.Clean("/"+filepath.ToSlash(name))))
+}
+
+func (d dirFS) Open(name string) (fs.File, error) {
+	return os.Open(d.join(name))
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(d.join(name))
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(d.join(name))
+}
+
+func (d dirFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(d.join(name), flag, perm)
+}
+
+func (d dirFS) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(d.join(name), perm)
+}
+
+func (d dirFS) RemoveAll(name string) error {
+	return os.RemoveAll(d.join(name))
+}
+
+func (d dirFS) Rename(oldname, newname string) error {
+	return os.Rename(d.join(oldname), d.join(newname))
+}
+
+func (d dirFS) Chmod(name string, mode fs.FileMode) error {
+	return os.Chmod(d.join(name), mode)
+}
+
+// Symlink creates links with relative targets, so that absolute targets are
+// resolved within dir like other paths, and refuses to create relative links
+// that lead outside of dir.
+func (d dirFS) Symlink(oldname, newname string) error {
+	link := d.join(newname)
+	var target string
+	if filepath.IsAbs(oldname) || path.IsAbs(filepath.ToSlash(oldname)) {
+		target = d.join(oldname)
+	} else {
+		target = filepath.Join(filepath.Dir(link), oldname)
+	}
+
+	rel, err := filepath.Rel(string(d), target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrPermission}
+	}
+	if target, err = filepath.Rel(filepath.Dir(link), target); err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	return os.Symlink(target, link)
+}
+
+func (d dirFS) Readlink(name string) (string, error) {
+	return os.Readlink(d.join(name))
+}
+
+func (d dirFS) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(d.join(name))
+}
+
+// ReadOnlyFS returns a filesystem that reads files from fsys, like an
+// embed.FS or an in-memory fstest.MapFS, and fails to write any files. Both
+// absolute and relative paths are resolved from the root of fsys.
+func ReadOnlyFS(fsys fs.FS) FS {
+	return readOnlyFS{fsys}
+}
+
+type readOnlyFS struct {
+	fsys fs.FS
+}
+
+var errReadOnlyFS = errors.New("read-only file system")
+
+// fsRootPath returns name as a path from the root of an io/fs filesystem,
+// resolving both absolute and relative paths from the root.
+func fsRootPath(name string) string {
+	name = path.Clean("/" + filepath.ToSlash(name))[1:]
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (r readOnlyFS) Open(name string) (fs.File, error) {
+	return r.fsys.Open(fsRootPath(name))
+}
+
+func (r readOnlyFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(r.fsys, fsRootPath(name))
+}
+
+func (r readOnlyFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(r.fsys, fsRootPath(name))
+}
+
+func (r readOnlyFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errReadOnlyFS}
+	}
+	file, err := r.fsys.Open(fsRootPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyFile{file}, nil
+}
+
+func (r readOnlyFS) MkdirAll(name string, perm fs.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: errReadOnlyFS}
+}
+
+func (r readOnlyFS) RemoveAll(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errReadOnlyFS}
+}
+
+type readOnlyFile struct {
+	fs.File
+}
+
+func (f readOnlyFile) Seek(offset int64, whence int) (int64, error) {
+	if seeker, ok := f.File.(io.Seeker); ok {
+		return seeker.Seek(offset, whence)
+	}
+	return 0, errors.New("file does not support seeking")
+}
+
+func (f readOnlyFile) Write(p []byte) (int, error) {
+	return 0, errReadOnlyFS
+}
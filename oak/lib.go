@@ -0,0 +1,99 @@
+package oak
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thesephist/oak/lib"
+)
+
+// Module is a library that a host program makes available to Oak programs,
+// which import it by name like a standard library. Its members may be
+// implemented in Go, in Oak, or both.
+type Module struct {
+	// Members are defined in the module before its Source is evaluated, and
+	// are usually Go functions wrapped with Bind or MakeBuiltinFn.
+	Members map[string]Value
+	// Source is Oak source text for the rest of the module. Its top-level
+	// definitions become members of the module, and it may refer to Members.
+	Source string
+}
+
+// RegisterModule makes the module importable with import(name) from programs
+// in this Context, and in every Context sharing its engine, like the modules
+// they import. A registered module takes precedence over a standard library
+// of the same name. Like standard libraries, each module is loaded at most
+// once, the first time it is imported.
+func (c *Context) RegisterModule(name string, mod Module) {
+	c.Lock()
+	defer c.Unlock()
+	c.eng.modules[name] = mod
+}
+
+func isStdLib(name string) bool {
+	_, ok := lib.Sources[name]
+	return ok
+}
+
+func (c *Context) isModule(name string) bool {
+	_, ok := c.eng.modules[name]
+	return ok || isStdLib(name)
+}
+
+// LoadLib loads the registered module or standard library with the given
+// name, or returns it if it has already been loaded.
+func (c *Context) LoadLib(name string) (Value, *RuntimeError) {
+	if imported, ok := c.eng.importMap[name]; ok {
+		return ObjectValue(imported.vars), nil
+	}
+
+	mod, ok := c.eng.modules[name]
+	if !ok {
+		program, ok := lib.Sources[name]
+		if !ok {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("%s is not a valid standard library; could not import", name),
+			}
+		}
+		mod = Module{Source: program}
+	}
+
+	ctx := c.ChildContext(c.rootPath)
+	ctx.LoadBuiltins()
+	for memberName, member := range mod.Members {
+		ctx.scope.put(memberName, member)
+	}
+
+	if mod.Source == "" {
+		c.eng.importMap[name] = ctx.scope
+		return ObjectValue(ctx.scope.vars), nil
+	}
+
+	ctx.Unlock()
+	_, err := ctx.EvalFile(name, strings.NewReader(mod.Source))
+	ctx.Lock()
+	if err != nil {
+		if runtimeErr, ok := err.(*RuntimeError); ok {
+			return nil, runtimeErr
+		} else {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("Error loading %s: %s", name, err.Error()),
+			}
+		}
+	}
+
+	c.eng.importMap[name] = ctx.scope
+	return ObjectValue(ctx.scope.vars), nil
+}
+
+// LoadAllLibs imports every standard library into this Context's global
+// scope, under its own name.
+func (c *Context) LoadAllLibs() error {
+	for libname := range lib.Sources {
+		_, err := c.Eval(strings.NewReader(fmt.Sprintf("%s := import('%s')", libname, libname)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package oak
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS returns an empty, writable filesystem held in memory, for running
+// programs that write files, for example in tests, without touching the disk.
+// Both absolute and relative paths are resolved from its root, as in
+// ReadOnlyFS. It supports rename() and chmod(), but not symbolic links.
+func MemFS() FS {
+	return &memFS{
+		nodes: map[string]*memNode{
+			".": {mode: fs.ModeDir | 0755, modTime: time.Now()},
+		},
+	}
+}
+
+type memFS struct {
+	// guards nodes and the contents of every node, which open files share
+	mu sync.Mutex
+	// every file and directory by its cleaned path from the root, which is "."
+	nodes map[string]*memNode
+}
+
+// memNode is a file or directory in a memFS.
+type memNode struct {
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+var errIsDir = errors.New("is a directory")
+var errNotDir = errors.New("not a directory")
+
+// info returns the FileInfo for the node at the cleaned path name, as of now.
+// It must be called while holding m.mu.
+func (m *memFS) info(name string, node *memNode) fs.FileInfo {
+	return memFileInfo{
+		name:    path.Base(name),
+		size:    int64(len(node.data)),
+		mode:    node.mode,
+		modTime: node.modTime,
+		node:    node,
+	}
+}
+
+// parent returns an error if the parent directory of the cleaned path name
+// does not exist. It must be called while holding m.mu.
+func (m *memFS) parent(op, name string) error {
+	parent, ok := m.nodes[path.Dir(name)]
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.mode.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+func (m *memFS) Open(name string) (fs.File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = fsRootPath(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return m.info(name, node), nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = fsRootPath(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	var entries []fs.DirEntry
+	for childName, child := range m.nodes {
+		if childName != "." && path.Dir(childName) == name {
+			entries = append(entries, memDirEntry{m.info(childName, child)})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = fsRootPath(name)
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	node, ok := m.nodes[name]
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case ok && node.mode.IsDir() && writable:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+	case ok:
+		if writable && flag&os.O_TRUNC != 0 {
+			node.data = nil
+			node.modTime = time.Now()
+		}
+	case flag&os.O_CREATE != 0:
+		if err := m.parent("open", name); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[name] = node
+	default:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &memFile{
+		fsys:     m,
+		name:     name,
+		node:     node,
+		readable: flag&os.O_WRONLY == 0,
+		writable: writable,
+		append:   flag&os.O_APPEND != 0,
+	}, nil
+}
+
+func (m *memFS) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = fsRootPath(name)
+	if name == "." {
+		return nil
+	}
+	dir := ""
+	for _, part := range strings.Split(name, "/") {
+		dir = path.Join(dir, part)
+		if node, ok := m.nodes[dir]; ok {
+			if !node.mode.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: dir, Err: errNotDir}
+			}
+			continue
+		}
+		m.nodes[dir] = &memNode{mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = fsRootPath(name)
+	for nodeName := range m.nodes {
+		if nodeName == "." {
+			continue
+		}
+		if name == "." || nodeName == name || strings.HasPrefix(nodeName, name+"/") {
+			delete(m.nodes, nodeName)
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Rename(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldname, newname = fsRootPath(oldname), fsRootPath(newname)
+	node, ok := m.nodes[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if oldname == newname {
+		return nil
+	}
+	if oldname == "." || strings.HasPrefix(newname, oldname+"/") {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrInvalid}
+	}
+	if err := m.parent("rename", newname); err != nil {
+		return err
+	}
+	if existing, ok := m.nodes[newname]; ok {
+		if existing.mode.IsDir() != node.mode.IsDir() {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrExist}
+		}
+		for nodeName := range m.nodes {
+			if strings.HasPrefix(nodeName, newname+"/") {
+				return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrExist}
+			}
+		}
+	}
+
+	for nodeName, child := range m.nodes {
+		if strings.HasPrefix(nodeName, oldname+"/") {
+			delete(m.nodes, nodeName)
+			m.nodes[newname+strings.TrimPrefix(nodeName, oldname)] = child
+		}
+	}
+	delete(m.nodes, oldname)
+	m.nodes[newname] = node
+	return nil
+}
+
+func (m *memFS) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = fsRootPath(name)
+	node, ok := m.nodes[name]
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+	node.mode = node.mode&^fs.ModePerm | mode.Perm()
+	return nil
+}
+
+// memFile is a file opened from a memFS. It reads and writes the contents of
+// its node directly, so that writes are seen by every open file at once.
+type memFile struct {
+	fsys     *memFS
+	name     string
+	node     *memNode
+	offset   int64
+	readable bool
+	writable bool
+	append   bool
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	return f.fsys.info(f.name, f.node), nil
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if f.node.mode.IsDir() {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errIsDir}
+	}
+	if !f.readable {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrPermission}
+	}
+	if f.offset >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.offset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	if !f.writable {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	if f.append {
+		f.offset = int64(len(f.node.data))
+	}
+	if end := f.offset + int64(len(p)); end > int64(len(f.node.data)) {
+		data := make([]byte, end)
+		copy(data, f.node.data)
+		f.node.data = data
+	}
+	copy(f.node.data[f.offset:], p)
+	f.offset += int64(len(p))
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	node    *memNode
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() fs.FileMode  { return i.mode }
+func (i memFileInfo) ModTime() time.Time { return i.modTime }
+func (i memFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memFileInfo) Sys() interface{}   { return i.node }
+
+type memDirEntry struct {
+	info fs.FileInfo
+}
+
+func (e memDirEntry) Name() string               { return e.info.Name() }
+func (e memDirEntry) IsDir() bool                { return e.info.IsDir() }
+func (e memDirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e memDirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
+
+// sameFile reports whether two FileInfos describe the same file, like
+// os.SameFile, for files from the OS filesystem or a MemFS.
+func sameFile(a, b fs.FileInfo) bool {
+	if node, ok := a.Sys().(*memNode); ok {
+		other, ok := b.Sys().(*memNode)
+		return ok && node == other
+	}
+	return os.SameFile(a, b)
+}
@@ -1,4 +1,4 @@
-package main
+package oak
 
 import (
 	"bytes"
@@ -9,11 +9,16 @@ import (
 
 type astNode interface {
 	String() string
+	// pos is the position of the token that best identifies the node in
+	// error messages, like the operator of a binary expression.
 	pos() pos
+	// loc is the range of source text the node was parsed from.
+	loc() span
 }
 
 type emptyNode struct {
 	tok *token
+	span
 }
 
 func (n emptyNode) String() string {
@@ -25,6 +30,7 @@ func (n emptyNode) pos() pos {
 
 type nullNode struct {
 	tok *token
+	span
 }
 
 func (n nullNode) String() string {
@@ -37,6 +43,7 @@ func (n nullNode) pos() pos {
 type stringNode struct {
 	payload []byte
 	tok     *token
+	span
 }
 
 func (n stringNode) String() string {
@@ -49,6 +56,7 @@ func (n stringNode) pos() pos {
 type intNode struct {
 	payload int64
 	tok     *token
+	span
 }
 
 func (n intNode) String() string {
@@ -61,6 +69,7 @@ func (n intNode) pos() pos {
 type floatNode struct {
 	payload float64
 	tok     *token
+	span
 }
 
 func (n floatNode) String() string {
@@ -73,6 +82,7 @@ func (n floatNode) pos() pos {
 type boolNode struct {
 	payload bool
 	tok     *token
+	span
 }
 
 func (n boolNode) String() string {
@@ -88,6 +98,7 @@ func (n boolNode) pos() pos {
 type atomNode struct {
 	payload string
 	tok     *token
+	span
 }
 
 func (n atomNode) String() string {
@@ -100,6 +111,7 @@ func (n atomNode) pos() pos {
 type listNode struct {
 	elems []astNode
 	tok   *token
+	span
 }
 
 func (n listNode) String() string {
@@ -125,6 +137,7 @@ func (n objectEntry) String() string {
 type objectNode struct {
 	entries []objectEntry
 	tok     *token
+	span
 }
 
 func (n objectNode) String() string {
@@ -144,6 +157,7 @@ type fnNode struct {
 	restArg string
 	body    astNode
 	tok     *token
+	span
 }
 
 func (n fnNode) String() string {
@@ -170,6 +184,7 @@ func (n fnNode) pos() pos {
 type identifierNode struct {
 	payload string
 	tok     *token
+	span
 }
 
 func (n identifierNode) String() string {
@@ -184,6 +199,7 @@ type assignmentNode struct {
 	left    astNode
 	right   astNode
 	tok     *token
+	span
 }
 
 func (n assignmentNode) String() string {
@@ -200,6 +216,7 @@ type propertyAccessNode struct {
 	left  astNode
 	right astNode
 	tok   *token
+	span
 }
 
 func (n propertyAccessNode) String() string {
@@ -213,6 +230,7 @@ type unaryNode struct {
 	op    tokKind
 	right astNode
 	tok   *token
+	span
 }
 
 func (n unaryNode) String() string {
@@ -228,6 +246,7 @@ type binaryNode struct {
 	left  astNode
 	right astNode
 	tok   *token
+	span
 }
 
 func (n binaryNode) String() string {
@@ -243,6 +262,7 @@ type fnCallNode struct {
 	args    []astNode
 	restArg astNode
 	tok     *token
+	span
 }
 
 func (n fnCallNode) String() string {
@@ -272,6 +292,7 @@ type ifExprNode struct {
 	cond     astNode
 	branches []ifBranch
 	tok      *token
+	span
 }
 
 func (n ifExprNode) String() string {
@@ -288,6 +309,7 @@ func (n ifExprNode) pos() pos {
 type blockNode struct {
 	exprs []astNode
 	tok   *token
+	span
 }
 
 func (n blockNode) String() string {
@@ -306,6 +328,8 @@ type parser struct {
 	tokens        []token
 	index         int
 	minBinaryPrec []int
+	// errors recovered from so far while parsing
+	errors []ParseError
 }
 
 func newParser(tokens []token) parser {
@@ -360,22 +384,36 @@ func (p *parser) back() {
 	}
 }
 
+// eofPos returns the position of the end of the input, where errors about an
+// unexpected end of input are reported. That is right after the last token
+// before the comma that ends the program, rather than after any whitespace
+// that follows it.
+func (p *parser) eofPos() pos {
+	n := len(p.tokens)
+	if n == 0 {
+		return pos{line: 1}
+	}
+	if last := p.tokens[n-1]; last.kind == comma && n > 1 && p.tokens[n-2].end.line > 0 {
+		return p.tokens[n-2].end
+	}
+	return p.tokens[n-1].pos
+}
+
+// spanFrom returns the span from start to the end of the last token read.
+func (p *parser) spanFrom(start pos) span {
+	return span{start: start, end: p.tokens[p.index-1].end}
+}
+
 func (p *parser) expect(kind tokKind) (token, error) {
 	tok := token{kind: kind}
 
 	if p.isEOF() {
-		return token{kind: unknown}, parseError{
-			reason: fmt.Sprintf("Unexpected end of input, expected %s", tok),
-			pos:    tok.pos,
-		}
+		return token{kind: unknown}, unexpectedEOF(tok.String(), p.eofPos())
 	}
 
 	next := p.next()
 	if next.kind != kind {
-		return token{kind: unknown}, parseError{
-			reason: fmt.Sprintf("Unexpected token %s, expected %s", next, tok),
-			pos:    next.pos,
-		}
+		return token{kind: unknown}, unexpectedToken(next, tok.String())
 	}
 
 	return next, nil
@@ -391,13 +429,140 @@ func (p *parser) readUntilTokenKind(kind tokKind) []token {
 
 // concrete astNode parse functions
 
-type parseError struct {
+// ParseError is a syntax error in an Oak program, with the position in
+// source at which it was found.
+type ParseError struct {
 	reason string
+	// descriptions of what the parser expected to find, and what it found
+	// instead
+	expected string
+	found    string
 	pos
+	// the source text the error refers to, which may be empty
+	span
+}
+
+func (e ParseError) Error() string {
+	msg := fmt.Sprintf("Parse error at %s: %s", e.pos.String(), e.reason)
+	if excerpt := e.span.excerpt(e.pos); excerpt != "" {
+		msg += "\n" + excerpt
+	}
+	return msg
+}
+
+// Position returns the file name, line, and column at which the error was
+// found. The file name is empty for programs not read from a file.
+func (e ParseError) Position() (file string, line, col int) {
+	return e.pos.fileName(), e.line, e.col
+}
+
+// Expected describes what the parser expected to find where the error was
+// found, and Found what it found instead.
+func (e ParseError) Expected() string {
+	return e.expected
 }
 
-func (e parseError) Error() string {
-	return fmt.Sprintf("Parse error at %s: %s", e.pos.String(), e.reason)
+func (e ParseError) Found() string {
+	return e.found
+}
+
+// SyntaxError is the error from evaluating a program that does not parse. It
+// lists every syntax error in the program, in the order they appear.
+type SyntaxError struct {
+	Errors []ParseError
+}
+
+func (e *SyntaxError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ParseErrors parses the Oak program in source without running it, and
+// returns every syntax error in it, in the order they appear. Positions in the
+// errors refer to the given file name.
+func ParseErrors(fileName string, source string) []ParseError {
+	tokenizer := newFileTokenizer(fileName, source)
+	parser := newParser(tokenizer.tokenize())
+	_, errs := parser.parseAll()
+	return errs
+}
+
+func unexpectedToken(found token, expected string) ParseError {
+	return ParseError{
+		reason:   fmt.Sprintf("Unexpected token %s, expected %s", found, expected),
+		expected: expected,
+		found:    found.String(),
+		pos:      found.pos,
+		span:     found.span(),
+	}
+}
+
+func unexpectedEOF(expected string, position pos) ParseError {
+	return ParseError{
+		reason:   fmt.Sprintf("Unexpected end of input, expected %s", expected),
+		expected: expected,
+		found:    "end of input",
+		pos:      position,
+	}
+}
+
+// recover records a parse error in the expression that began at the token
+// index start, and skips the rest of that expression, so parsing can resume
+// at the next expression in the enclosing list, block, or program. Skipping
+// stops after the next comma (which includes newlines) at the nesting depth
+// of start, or before a closing delimiter that ends the enclosing form.
+func (p *parser) recover(err error, start int) {
+	// a malformed expression just before a closing delimiter fails at the
+	// comma inserted before the delimiter, and resuming there fails again at
+	// the delimiter itself, in the same place, so that error is not repeated
+	perr := err.(ParseError)
+	if n := len(p.errors); n == 0 || p.errors[n-1].pos != perr.pos {
+		p.errors = append(p.errors, perr)
+	}
+
+	depth := 0
+	for _, tok := range p.tokens[start:p.index] {
+		switch tok.kind {
+		case leftParen, leftBracket, leftBrace:
+			depth++
+		case rightParen, rightBracket, rightBrace:
+			depth--
+		}
+	}
+	if depth < 0 {
+		// the malformed expression already consumed the end of the
+		// enclosing form, or a stray closing delimiter
+		if !p.isEOF() && p.peek().kind == comma {
+			p.next()
+		}
+		return
+	}
+	if depth == 0 && p.index > start && p.tokens[p.index-1].kind == comma {
+		// the malformed expression ended at the comma where the error
+		// occurred
+		return
+	}
+
+	for !p.isEOF() {
+		switch p.peek().kind {
+		case leftParen, leftBracket, leftBrace:
+			depth++
+		case rightParen, rightBracket, rightBrace:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case comma:
+			if depth == 0 {
+				p.next()
+				return
+			}
+		}
+		p.next()
+	}
 }
 
 func (p *parser) parseAssignment(left astNode) (astNode, error) {
@@ -418,6 +583,7 @@ func (p *parser) parseAssignment(left astNode) (astNode, error) {
 		return nil, err
 	}
 	node.right = right
+	node.span = p.spanFrom(left.loc().start)
 
 	return node, nil
 }
@@ -426,10 +592,14 @@ func (p *parser) parseAssignment(left astNode) (astNode, error) {
 // of Oak's syntax, like literals including function literals, grouped
 // expressions in blocks, and if/with expressions.
 func (p *parser) parseUnit() (astNode, error) {
+	if p.isEOF() {
+		return nil, unexpectedEOF("an expression", p.eofPos())
+	}
+
 	tok := p.next()
 	switch tok.kind {
 	case qmark:
-		return nullNode{tok: &tok}, nil
+		return nullNode{tok: &tok, span: p.spanFrom(tok.pos)}, nil
 	case stringLiteral:
 		payloadBuilder := bytes.Buffer{}
 		runes := []rune(tok.payload)
@@ -472,53 +642,74 @@ func (p *parser) parseUnit() (astNode, error) {
 				_, _ = payloadBuilder.WriteRune(c)
 			}
 		}
-		return stringNode{payload: payloadBuilder.Bytes(), tok: &tok}, nil
+		return stringNode{payload: payloadBuilder.Bytes(), tok: &tok, span: p.spanFrom(tok.pos)}, nil
 	case numberLiteral:
 		if strings.ContainsRune(tok.payload, '.') {
 			f, err := strconv.ParseFloat(tok.payload, 64)
 			if err != nil {
-				return nil, parseError{reason: err.Error(), pos: tok.pos}
+				return nil, ParseError{
+					reason:   err.Error(),
+					expected: "a valid number",
+					found:    tok.String(),
+					pos:      tok.pos,
+					span:     tok.span(),
+				}
 			}
 			return floatNode{
 				payload: f,
 				tok:     &tok,
+				span:    p.spanFrom(tok.pos),
 			}, nil
 		}
 		n, err := strconv.ParseInt(tok.payload, 10, 64)
 		if err != nil {
-			return nil, parseError{reason: err.Error(), pos: tok.pos}
+			return nil, ParseError{
+				reason:   err.Error(),
+				expected: "a valid number",
+				found:    tok.String(),
+				pos:      tok.pos,
+				span:     tok.span(),
+			}
 		}
 		return intNode{
 			payload: n,
 			tok:     &tok,
+			span:    p.spanFrom(tok.pos),
 		}, nil
 	case trueLiteral:
-		return boolNode{payload: true, tok: &tok}, nil
+		return boolNode{payload: true, tok: &tok, span: p.spanFrom(tok.pos)}, nil
 	case falseLiteral:
-		return boolNode{payload: false, tok: &tok}, nil
+		return boolNode{payload: false, tok: &tok, span: p.spanFrom(tok.pos)}, nil
 	case colon:
+		if p.isEOF() {
+			return nil, unexpectedEOF("identifier after ':'", p.eofPos())
+		}
+
 		switch p.peek().kind {
 		case identifier:
-			return atomNode{payload: p.next().payload, tok: &tok}, nil
+			return atomNode{payload: p.next().payload, tok: &tok, span: p.spanFrom(tok.pos)}, nil
 		case ifKeyword:
 			p.next()
-			return atomNode{payload: "if", tok: &tok}, nil
+			return atomNode{payload: "if", tok: &tok, span: p.spanFrom(tok.pos)}, nil
 		case fnKeyword:
 			p.next()
-			return atomNode{payload: "fn", tok: &tok}, nil
+			return atomNode{payload: "fn", tok: &tok, span: p.spanFrom(tok.pos)}, nil
 		case withKeyword:
 			p.next()
-			return atomNode{payload: "with", tok: &tok}, nil
+			return atomNode{payload: "with", tok: &tok, span: p.spanFrom(tok.pos)}, nil
 		case trueLiteral:
 			p.next()
-			return atomNode{payload: "true", tok: &tok}, nil
+			return atomNode{payload: "true", tok: &tok, span: p.spanFrom(tok.pos)}, nil
 		case falseLiteral:
 			p.next()
-			return atomNode{payload: "false", tok: &tok}, nil
+			return atomNode{payload: "false", tok: &tok, span: p.spanFrom(tok.pos)}, nil
 		}
-		return nil, parseError{
-			reason: fmt.Sprintf("Expected identifier after ':', got %s", p.peek()),
-			pos:    tok.pos,
+		return nil, ParseError{
+			reason:   fmt.Sprintf("Expected identifier after ':', got %s", p.peek()),
+			expected: "identifier after ':'",
+			found:    p.peek().String(),
+			pos:      tok.pos,
+			span:     span{start: tok.pos, end: p.peek().end},
 		}
 	case leftBracket:
 		p.pushMinPrec(0)
@@ -526,12 +717,14 @@ func (p *parser) parseUnit() (astNode, error) {
 
 		itemNodes := []astNode{}
 		for !p.isEOF() && p.peek().kind != rightBracket {
+			start := p.index
 			node, err := p.parseNode()
-			if err != nil {
-				return nil, err
+			if err == nil {
+				_, err = p.expect(comma)
 			}
-			if _, err := p.expect(comma); err != nil {
-				return nil, err
+			if err != nil {
+				p.recover(err, start)
+				continue
 			}
 
 			itemNodes = append(itemNodes, node)
@@ -540,7 +733,7 @@ func (p *parser) parseUnit() (astNode, error) {
 			return nil, err
 		}
 
-		return listNode{elems: itemNodes, tok: &tok}, nil
+		return listNode{elems: itemNodes, tok: &tok, span: p.spanFrom(tok.pos)}, nil
 	case leftBrace:
 		p.pushMinPrec(0)
 		defer p.popMinPrec()
@@ -548,77 +741,73 @@ func (p *parser) parseUnit() (astNode, error) {
 		// empty {} is always considered an object -- an empty block is illegal
 		if p.peek().kind == rightBrace {
 			p.next() // eat the rightBrace
-			return objectNode{entries: []objectEntry{}, tok: &tok}, nil
+			return objectNode{entries: []objectEntry{}, tok: &tok, span: p.spanFrom(tok.pos)}, nil
 		}
 
+		start := p.index
+		exprs := []astNode{}
 		firstExpr, err := p.parseNode()
 		if err != nil {
-			return nil, err
-		}
-		if p.isEOF() {
-			return nil, parseError{
-				reason: fmt.Sprintf("Unexpected end of input inside block or object"),
-				pos:    tok.pos,
-			}
-		}
-
-		if p.peek().kind == colon {
-			// it's an object
-			p.next() // eat the colon
-			valExpr, err := p.parseNode()
-			if err != nil {
-				return nil, err
-			}
-			if _, err := p.expect(comma); err != nil {
-				return nil, err
-			}
-
-			entries := []objectEntry{
-				{key: firstExpr, val: valExpr},
+			// without a valid first expression, we can't tell a block from an
+			// object, so we recover as if it were a block
+			p.recover(err, start)
+		} else {
+			if p.isEOF() {
+				return nil, ParseError{
+					reason:   fmt.Sprintf("Unexpected end of input inside block or object"),
+					expected: "} to close block or object",
+					found:    "end of input",
+					pos:      tok.pos,
+				}
 			}
 
-			for !p.isEOF() && p.peek().kind != rightBrace {
-				key, err := p.parseNode()
-				if err != nil {
-					return nil, err
+			if p.peek().kind == colon {
+				// it's an object
+				p.next() // eat the colon
+				entries := []objectEntry{}
+				valExpr, err := p.parseNode()
+				if err == nil {
+					_, err = p.expect(comma)
 				}
-				if _, err := p.expect(colon); err != nil {
-					return nil, err
+				if err != nil {
+					p.recover(err, start)
+				} else {
+					entries = append(entries, objectEntry{key: firstExpr, val: valExpr})
 				}
 
-				val, err := p.parseNode()
-				if err != nil {
-					return nil, err
+				for !p.isEOF() && p.peek().kind != rightBrace {
+					start := p.index
+					entry, err := p.parseObjectEntry()
+					if err != nil {
+						p.recover(err, start)
+						continue
+					}
+
+					entries = append(entries, entry)
 				}
-				if _, err := p.expect(comma); err != nil {
+				if _, err := p.expect(rightBrace); err != nil {
 					return nil, err
 				}
 
-				entries = append(entries, objectEntry{
-					key: key,
-					val: val,
-				})
-			}
-			if _, err := p.expect(rightBrace); err != nil {
-				return nil, err
+				return objectNode{entries: entries, tok: &tok, span: p.spanFrom(tok.pos)}, nil
 			}
 
-			return objectNode{entries: entries, tok: &tok}, nil
-		}
-
-		// it's a block
-		exprs := []astNode{firstExpr}
-		if _, err := p.expect(comma); err != nil {
-			return nil, err
+			// it's a block
+			exprs = append(exprs, firstExpr)
+			if _, err := p.expect(comma); err != nil {
+				p.recover(err, start)
+			}
 		}
 
 		for !p.isEOF() && p.peek().kind != rightBrace {
+			start := p.index
 			expr, err := p.parseNode()
-			if err != nil {
-				return nil, err
+			if err == nil {
+				_, err = p.expect(comma)
 			}
-			if _, err := p.expect(comma); err != nil {
-				return nil, err
+			if err != nil {
+				p.recover(err, start)
+				continue
 			}
 
 			exprs = append(exprs, expr)
@@ -627,7 +816,7 @@ func (p *parser) parseUnit() (astNode, error) {
 			return nil, err
 		}
 
-		return blockNode{exprs: exprs, tok: &tok}, nil
+		return blockNode{exprs: exprs, tok: &tok, span: p.spanFrom(tok.pos)}, nil
 	case fnKeyword:
 		p.pushMinPrec(0)
 		defer p.popMinPrec()
@@ -693,7 +882,7 @@ func (p *parser) parseUnit() (astNode, error) {
 		// Exception to the "{} is empty object" rule is that `fn {}` parses as
 		// a function with an empty block as a body
 		if objBody, ok := body.(objectNode); ok && len(objBody.entries) == 0 {
-			body = blockNode{exprs: []astNode{}, tok: objBody.tok}
+			body = blockNode{exprs: []astNode{}, tok: objBody.tok, span: objBody.span}
 		}
 
 		return fnNode{
@@ -702,11 +891,12 @@ func (p *parser) parseUnit() (astNode, error) {
 			restArg: restArg,
 			body:    body,
 			tok:     &tok,
+			span:    p.spanFrom(tok.pos),
 		}, nil
 	case underscore:
-		return emptyNode{tok: &tok}, nil
+		return emptyNode{tok: &tok, span: p.spanFrom(tok.pos)}, nil
 	case identifier:
-		return identifierNode{payload: tok.payload, tok: &tok}, nil
+		return identifierNode{payload: tok.payload, tok: &tok, span: p.spanFrom(tok.pos)}, nil
 	case minus, exclam:
 		right, err := p.parseSubNode()
 		if err != nil {
@@ -717,6 +907,7 @@ func (p *parser) parseUnit() (astNode, error) {
 			op:    tok.kind,
 			right: right,
 			tok:   &tok,
+			span:  p.spanFrom(tok.pos),
 		}, nil
 	case ifKeyword:
 		p.pushMinPrec(0)
@@ -733,6 +924,7 @@ func (p *parser) parseUnit() (astNode, error) {
 			condNode = boolNode{
 				payload: true,
 				tok:     &tok,
+				span:    p.spanFrom(tok.pos),
 			}
 		} else {
 			condNode, err = p.parseNode()
@@ -759,6 +951,7 @@ func (p *parser) parseUnit() (astNode, error) {
 				target: boolNode{
 					payload: true,
 					tok:     &arrowTok,
+					span:    arrowTok.span(),
 				},
 				body: body,
 			})
@@ -766,6 +959,7 @@ func (p *parser) parseUnit() (astNode, error) {
 				cond:     condNode,
 				branches: branches,
 				tok:      &tok,
+				span:     p.spanFrom(tok.pos),
 			}, nil
 		}
 
@@ -824,6 +1018,7 @@ func (p *parser) parseUnit() (astNode, error) {
 			cond:     condNode,
 			branches: branches,
 			tok:      &tok,
+			span:     p.spanFrom(tok.pos),
 		}, nil
 	case withKeyword:
 		p.pushMinPrec(0)
@@ -836,9 +1031,12 @@ func (p *parser) parseUnit() (astNode, error) {
 
 		withExprBaseCall, ok := withExprBase.(fnCallNode)
 		if !ok {
-			return nil, parseError{
-				reason: fmt.Sprintf("with keyword should be followed by a function call, found %s", withExprBase),
-				pos:    tok.pos,
+			return nil, ParseError{
+				reason:   fmt.Sprintf("with keyword should be followed by a function call, found %s", withExprBase),
+				expected: "function call after with",
+				found:    withExprBase.String(),
+				pos:      tok.pos,
+				span:     p.spanFrom(tok.pos),
 			}
 		}
 
@@ -848,6 +1046,7 @@ func (p *parser) parseUnit() (astNode, error) {
 		}
 
 		withExprBaseCall.args = append(withExprBaseCall.args, withExprLastArg)
+		withExprBaseCall.span = p.spanFrom(tok.pos)
 		return withExprBaseCall, nil
 	case leftParen:
 		p.pushMinPrec(0)
@@ -855,12 +1054,14 @@ func (p *parser) parseUnit() (astNode, error) {
 
 		exprs := []astNode{}
 		for !p.isEOF() && p.peek().kind != rightParen {
+			start := p.index
 			expr, err := p.parseNode()
-			if err != nil {
-				return nil, err
+			if err == nil {
+				_, err = p.expect(comma)
 			}
-			if _, err := p.expect(comma); err != nil {
-				return nil, err
+			if err != nil {
+				p.recover(err, start)
+				continue
 			}
 
 			exprs = append(exprs, expr)
@@ -870,14 +1071,42 @@ func (p *parser) parseUnit() (astNode, error) {
 		}
 		// TODO: If only one body expr and body expr is identifier or literal,
 		// unwrap the blockNode and just return the bare child
-		return blockNode{exprs: exprs, tok: &tok}, nil
+		return blockNode{exprs: exprs, tok: &tok, span: p.spanFrom(tok.pos)}, nil
+	case comma:
+		if p.isEOF() {
+			// the comma that closes the last expression in the program
+			return nil, unexpectedEOF("an expression", p.eofPos())
+		}
 	}
-	return nil, parseError{
-		reason: fmt.Sprintf("Unexpected token %s at start of unit", tok),
-		pos:    tok.pos,
+	return nil, ParseError{
+		reason:   fmt.Sprintf("Unexpected token %s at start of unit", tok),
+		expected: "an expression",
+		found:    tok.String(),
+		pos:      tok.pos,
+		span:     tok.span(),
 	}
 }
 
+func (p *parser) parseObjectEntry() (objectEntry, error) {
+	key, err := p.parseNode()
+	if err != nil {
+		return objectEntry{}, err
+	}
+	if _, err := p.expect(colon); err != nil {
+		return objectEntry{}, err
+	}
+
+	val, err := p.parseNode()
+	if err != nil {
+		return objectEntry{}, err
+	}
+	if _, err := p.expect(comma); err != nil {
+		return objectEntry{}, err
+	}
+
+	return objectEntry{key: key, val: val}, nil
+}
+
 func infixOpPrecedence(op tokKind) int {
 	switch op {
 	case plus, minus:
@@ -927,6 +1156,7 @@ func (p *parser) parseSubNode() (astNode, error) {
 				left:  node,
 				right: right,
 				tok:   &next,
+				span:  p.spanFrom(node.loc().start),
 			}
 		case leftParen:
 			next := p.next() // eat the leftParen
@@ -965,6 +1195,7 @@ func (p *parser) parseSubNode() (astNode, error) {
 				args:    args,
 				restArg: restArg,
 				tok:     &next,
+				span:    p.spanFrom(node.loc().start),
 			}
 		default:
 			return node, nil
@@ -998,10 +1229,7 @@ func (p *parser) parseNode() (astNode, error) {
 
 			for {
 				if p.isEOF() {
-					return nil, parseError{
-						reason: "Incomplete binary expression",
-						pos:    p.peek().pos,
-					}
+					return nil, unexpectedEOF("binary operator", p.eofPos())
 				}
 
 				peeked := p.peek()
@@ -1013,9 +1241,11 @@ func (p *parser) parseNode() (astNode, error) {
 				p.next() // eat the operator
 
 				if p.isEOF() {
-					return nil, parseError{
-						reason: fmt.Sprintf("Incomplete binary expression with %s", token{kind: op}),
-						pos:    p.peek().pos,
+					return nil, ParseError{
+						reason:   fmt.Sprintf("Incomplete binary expression with %s", token{kind: op}),
+						expected: fmt.Sprintf("right operand of %s", token{kind: op}),
+						found:    "end of input",
+						pos:      p.eofPos(),
 					}
 				}
 
@@ -1031,6 +1261,7 @@ func (p *parser) parseNode() (astNode, error) {
 					left:  node,
 					right: right,
 					tok:   &peeked,
+					span:  p.spanFrom(node.loc().start),
 				}
 			}
 
@@ -1046,13 +1277,17 @@ func (p *parser) parseNode() (astNode, error) {
 			}
 			pipedFnCall, ok := pipeRight.(fnCallNode)
 			if !ok {
-				return nil, parseError{
-					reason: fmt.Sprintf("Expected function call after |>, got %s", pipeRight),
-					pos:    pipe.pos,
+				return nil, ParseError{
+					reason:   fmt.Sprintf("Expected function call after |>, got %s", pipeRight),
+					expected: "function call after |>",
+					found:    pipeRight.String(),
+					pos:      pipe.pos,
+					span:     p.spanFrom(pipe.pos),
 				}
 			}
 
 			pipedFnCall.args = append([]astNode{node}, pipedFnCall.args...)
+			pipedFnCall.span = p.spanFrom(node.loc().start)
 			node = pipedFnCall
 		default:
 			return node, nil
@@ -1063,21 +1298,32 @@ func (p *parser) parseNode() (astNode, error) {
 	return node, nil
 }
 
-func (p *parser) parse() ([]astNode, error) {
+// parseAll parses the whole program, recovering from syntax errors to report
+// every error in the program in the order they appear. Expressions containing
+// errors are left out of the returned nodes.
+func (p *parser) parseAll() ([]astNode, []ParseError) {
 	nodes := []astNode{}
 
 	for !p.isEOF() {
+		start := p.index
 		node, err := p.parseNode()
-		if err != nil {
-			return nodes, err
+		if err == nil {
+			_, err = p.expect(comma)
 		}
-
-		if _, err = p.expect(comma); err != nil {
-			return nodes, err
+		if err != nil {
+			p.recover(err, start)
+			if p.index == start {
+				// stray closing delimiter at the top level
+				p.next()
+			}
+			for !p.isEOF() && p.peek().kind == comma {
+				p.next()
+			}
+			continue
 		}
 
 		nodes = append(nodes, node)
 	}
 
-	return nodes, nil
+	return nodes, p.errors
 }
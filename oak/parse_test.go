@@ -0,0 +1,152 @@
+package oak
+
+import (
+	"strings"
+	"testing"
+)
+
+func expectParseErrors(t *testing.T, program string, expected []ParseError) []astNode {
+	tokenizer := newTokenizer(program)
+	parser := newParser(tokenizer.tokenize())
+	nodes, errs := parser.parseAll()
+
+	if len(errs) != len(expected) {
+		t.Errorf("Expected %d parse errors, got %d: %v", len(expected), len(errs), errs)
+		return nodes
+	}
+	for i, err := range errs {
+		exp := expected[i]
+		if err.line != exp.line || err.col != exp.col ||
+			err.expected != exp.expected || err.found != exp.found {
+			t.Errorf("Expected parse error %d to be %s (expected %s, found %s), got %s (expected %s, found %s)",
+				i, exp.pos, exp.expected, exp.found, err.pos, err.expected, err.found)
+		}
+	}
+	return nodes
+}
+
+func TestParseNoErrors(t *testing.T) {
+	nodes := expectParseErrors(t, "x := 1\ny := [x, 2]", []ParseError{})
+	if len(nodes) != 2 {
+		t.Errorf("Expected 2 nodes, got %d", len(nodes))
+	}
+}
+
+func TestParseReportsEveryError(t *testing.T) {
+	nodes := expectParseErrors(t, `a := 1 |> 2
+b := [1, 2 3]
+c := 3`, []ParseError{
+		{pos: pos{line: 1, col: 8}, expected: "function call after |>", found: "2"},
+		{pos: pos{line: 2, col: 12}, expected: ",", found: "number(3)"},
+	})
+	if len(nodes) != 2 {
+		t.Errorf("Expected 2 nodes, got %d", len(nodes))
+	}
+}
+
+func TestParseRecoversInsideBlock(t *testing.T) {
+	nodes := expectParseErrors(t, `fn f {
+	x := )
+	y := 2
+	z := 1 |> 3
+}
+w := 4`, []ParseError{
+		{pos: pos{line: 2, col: 7}, expected: "an expression", found: ","},
+		{pos: pos{line: 4, col: 9}, expected: "function call after |>", found: "3"},
+	})
+	if len(nodes) != 2 {
+		t.Errorf("Expected 2 nodes, got %d", len(nodes))
+	}
+}
+
+func TestParseRecoversInsideObject(t *testing.T) {
+	expectParseErrors(t, `{a: , b: 2, c: 3 4}`, []ParseError{
+		{pos: pos{line: 1, col: 5}, expected: "an expression", found: ","},
+		{pos: pos{line: 1, col: 18}, expected: ",", found: "number(4)"},
+	})
+}
+
+func TestParseUnexpectedEndOfInput(t *testing.T) {
+	expectParseErrors(t, `f(1, 2`, []ParseError{
+		{pos: pos{line: 1, col: 7}, expected: ")", found: "end of input"},
+	})
+}
+
+func TestParseErrorsAPI(t *testing.T) {
+	errs := ParseErrors("bad.oak", "x := )\ny := ]\nz := 1 |> 2")
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 parse errors, got %d: %v", len(errs), errs)
+	}
+	for i, err := range errs {
+		file, line, _ := err.Position()
+		if file != "bad.oak" || line != i+1 {
+			t.Errorf("Expected parse error %d at bad.oak line %d, got %s", i, i+1, err.pos)
+		}
+	}
+	if errs[2].Expected() != "function call after |>" || errs[2].Found() != "2" {
+		t.Errorf("Expected last error to describe the pipe, got expected %s, found %s",
+			errs[2].Expected(), errs[2].Found())
+	}
+
+	if errs := ParseErrors("", "x := [1, 2]"); len(errs) != 0 {
+		t.Errorf("Expected no parse errors, got %v", errs)
+	}
+}
+
+func TestEvalReportsEveryParseError(t *testing.T) {
+	ctx := NewContext("/tmp")
+	_, err := ctx.EvalFile("bad.oak", strings.NewReader("x := )\ny := ]"))
+	syntaxErr, ok := err.(*SyntaxError)
+	if !ok || len(syntaxErr.Errors) != 2 {
+		t.Fatalf("Expected a syntax error listing 2 parse errors, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "[bad.oak:1:6]") || !strings.Contains(err.Error(), "[bad.oak:2:6]") {
+		t.Errorf("Expected error message to include every parse error, got %s", err)
+	}
+}
+
+func TestNodeSpans(t *testing.T) {
+	source := "x := f(1, 2) + y.z\n[1, 2] |> g()"
+	tokenizer := newFileTokenizer("spans.oak", source)
+	parser := newParser(tokenizer.tokenize())
+	nodes, errs := parser.parseAll()
+	if len(errs) > 0 {
+		t.Fatalf("Did not expect parse error, got %s", errs[0])
+	}
+
+	assignment := nodes[0].(assignmentNode)
+	sum := assignment.right.(binaryNode)
+	pipe := nodes[1].(fnCallNode)
+	for _, tc := range []struct {
+		node     astNode
+		expected string
+	}{
+		{assignment, "x := f(1, 2) + y.z"},
+		{assignment.left, "x"},
+		{sum, "f(1, 2) + y.z"},
+		{sum.left, "f(1, 2)"},
+		{sum.right, "y.z"},
+		{pipe, "[1, 2] |> g()"},
+		{pipe.args[0], "[1, 2]"},
+	} {
+		loc := tc.node.loc()
+		if loc.start.fileName() != "spans.oak" {
+			t.Errorf("Expected span of %s to be in spans.oak, got %s", tc.node, loc.start.fileName())
+		}
+		if text := string([]rune(source)[loc.start.offset:loc.end.offset]); text != tc.expected {
+			t.Errorf("Expected span of %s to cover %q, got %q", tc.node, tc.expected, text)
+		}
+	}
+}
+
+func TestParseErrorExcerpt(t *testing.T) {
+	tokenizer := newFileTokenizer("bad.oak", "x := 1\ny := [1, 2 3]")
+	parser := newParser(tokenizer.tokenize())
+	_, errs := parser.parseAll()
+	expected := `Parse error at [bad.oak:2:12]: Unexpected token number(3), expected ,
+2 | y := [1, 2 3]
+  |            ^`
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("Expected error:\n%s\ngot:\n%v", expected, errs)
+	}
+}
@@ -0,0 +1,221 @@
+package oak
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FSAccess is the level of filesystem access granted to Oak programs.
+type FSAccess int
+
+const (
+	FSNone FSAccess = iota
+	FSReadOnly
+	FSReadWrite
+)
+
+// Policy determines what builtins may do on behalf of Oak programs in a
+// Context. Calls to builtins that the policy denies return an error event,
+// like any other failed call, rather than doing anything.
+type Policy struct {
+	// filesystem access for file builtins and imports of Oak source files
+	FS FSAccess
+	// if not empty, filesystem access is limited to files under these
+	// directories, which are paths in the Context's FS like those Oak programs
+	// use. In a DirFS, they are paths within its directory.
+	FSRoots []string
+	// running other programs with exec()
+	Exec bool
+	// making network requests with req()
+	NetClient bool
+	// serving network requests with listen()
+	NetServer bool
+	// ending evaluation with exit()
+	Exit bool
+	// handling signals sent to the host process with signal()
+	Signal bool
+}
+
+// AllowAllPolicy lets Oak programs do anything the host process can do. It is
+// the policy for contexts created with NewContext.
+var AllowAllPolicy = Policy{
+	FS:        FSReadWrite,
+	Exec:      true,
+	NetClient: true,
+	NetServer: true,
+	Exit:      true,
+	Signal:    true,
+}
+
+func deniedErr(fnName string) ObjectValue {
+	return errObj(fmt.Sprintf("%s() is not permitted in this context", fnName))
+}
+
+// deny returns an error event for a call to fnName if allowed is false, and
+// nil otherwise.
+func (c *Context) deny(fnName string, allowed bool) Value {
+	if allowed {
+		return nil
+	}
+	return deniedErr(fnName)
+}
+
+// denyFS returns an error event for a call to fnName if the policy does not
+// allow it to access the file at path, for writing if write is set, and nil
+// otherwise.
+func (c *Context) denyFS(fnName string, path string, write bool) Value {
+	if reason := c.fsDenial(fnName, path, write); reason != "" {
+		return errObj(reason)
+	}
+	return nil
+}
+
+// denyOSPath is like denyFS, for a path in the OS filesystem regardless of
+// the engine's FS, like that of a Unix socket.
+func (c *Context) denyOSPath(fnName string, path string, write bool) Value {
+	if reason := c.fsDenialIn(osFS{}, fnName, path, write); reason != "" {
+		return errObj(reason)
+	}
+	return nil
+}
+
+// fsDenial returns why the policy does not allow fnName to access the file at
+// path, or "" if it does.
+func (c *Context) fsDenial(fnName string, path string, write bool) string {
+	return c.fsDenialIn(c.eng.fs, fnName, path, write)
+}
+
+// fsDenialIn is like fsDenial, for a file in fsys. Both path and the policy's
+// FSRoots are paths in fsys.
+func (c *Context) fsDenialIn(fsys FS, fnName string, path string, write bool) string {
+	switch {
+	case c.policy.FS == FSNone:
+		return fmt.Sprintf("%s() is not permitted in this context", fnName)
+	case write && c.policy.FS != FSReadWrite:
+		return fmt.Sprintf("%s() is not permitted to write files in this context", fnName)
+	}
+
+	if len(c.policy.FSRoots) == 0 {
+		return ""
+	}
+
+	resolved, err := resolvePath(fsys, path)
+	if err != nil {
+		return fmt.Sprintf("Could not resolve path %s: %s", path, err.Error())
+	}
+	for _, root := range c.policy.FSRoots {
+		resolvedRoot, err := resolvePath(fsys, root)
+		if err != nil {
+			continue
+		}
+		if resolved == resolvedRoot ||
+			strings.HasPrefix(resolved, strings.TrimSuffix(resolvedRoot, "/")+"/") {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s() is not permitted to access %s in this context", fnName, path)
+}
+
+// resolvePath returns the slash-separated path to the file at name in fsys
+// with any symbolic links in it resolved, so that links cannot be used to
+// escape an allowed directory. The file itself and some of its parent
+// directories need not exist yet.
+func resolvePath(fsys FS, name string) (string, error) {
+	var resolved string
+	var err error
+	switch fsys := fsys.(type) {
+	case osFS:
+		resolved, err = resolveOSPath(name)
+	case dirFS:
+		// resolving the path in the OS filesystem catches links that lead
+		// outside of the directory
+		resolved, err = resolveOSPath(fsys.join(name))
+	default:
+		return resolveFSPath(fsys, name)
+	}
+	return filepath.ToSlash(resolved), err
+}
+
+// resolveOSPath resolves a path in the OS filesystem for resolvePath,
+// returning an absolute path.
+func resolveOSPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	existing, rest := abs, ""
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved, rest), nil
+}
+
+// maxLinkHops is the most symbolic links resolveFSPath follows in one path
+// before giving up, as with a cycle of links.
+const maxLinkHops = 255
+
+// resolveFSPath resolves a path in any other FS for resolvePath. Paths are
+// taken to be relative to the root of fsys, as in ReadOnlyFS, and the result
+// is an absolute, slash-separated path from its root. Only an FS that
+// implements SymlinkFS has links to follow.
+func resolveFSPath(fsys FS, name string) (string, error) {
+	cleaned := path.Clean("/" + filepath.ToSlash(name))
+	links, ok := fsys.(SymlinkFS)
+	if !ok {
+		return cleaned, nil
+	}
+
+	resolved := "/"
+	rest := strings.Split(strings.TrimPrefix(cleaned, "/"), "/")
+	for hops := 0; len(rest) > 0; {
+		part := rest[0]
+		rest = rest[1:]
+		if part == "" {
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		info, err := links.Lstat(next)
+		if err != nil {
+			// the rest of the path does not exist yet
+			return path.Join(append([]string{next}, rest...)...), nil
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if hops++; hops > maxLinkHops {
+			return "", fmt.Errorf("too many links in %s", name)
+		}
+		target, err := links.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		target = filepath.ToSlash(target)
+		if !path.IsAbs(target) {
+			target = path.Join(resolved, target)
+		}
+		resolved = "/"
+		rest = append(strings.Split(strings.TrimPrefix(path.Clean(target), "/"), "/"), rest...)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,259 @@
+package oak
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// exitStatus returns the exit status of a command from the error cmd.Wait
+// returned, which is -1 if it was ended by a signal or could not be waited on.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
+
+// writeQueue queues writes to a child process's stdin or a connection, so
+// that writing never blocks the interpreter while the other end is busy.
+type writeQueue struct {
+	mu     sync.Mutex
+	queue  [][]byte
+	closed bool
+	// receives a value when there is something to write, or when closed
+	ready chan struct{}
+}
+
+func newWriteQueue() *writeQueue {
+	return &writeQueue{ready: make(chan struct{}, 1)}
+}
+
+func (p *writeQueue) push(data []byte, close bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	if data != nil {
+		p.queue = append(p.queue, data)
+	}
+	p.closed = close
+
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// run writes queued data to w until the queue is closed, and then closes w.
+// If a write fails, later writes are dropped and onErr, if not nil, is called
+// with the error.
+func (p *writeQueue) run(w io.WriteCloser, onErr func(error)) {
+	defer w.Close()
+	for range p.ready {
+		p.mu.Lock()
+		queue, closed := p.queue, p.closed
+		p.queue = nil
+		p.mu.Unlock()
+
+		for _, data := range queue {
+			if _, err := w.Write(data); err != nil {
+				p.push(nil, true)
+				if onErr != nil {
+					onErr(err)
+				}
+				return
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// spawnCmd returns the command for a call to spawn().
+func spawnCmd(c *Context, args []Value) (*exec.Cmd, *RuntimeError) {
+	path, ok1 := args[0].(*StringValue)
+	cliArgs, ok2 := args[1].(*ListValue)
+	options, ok3 := args[2].(ObjectValue)
+	if _, isNull := args[2].(NullValue); isNull {
+		options, ok3 = ObjectValue{}, true
+	}
+	if !ok1 || !ok2 || !ok3 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call spawn(%s, %s, %s)", args[0], args[1], args[2]),
+		}
+	}
+
+	argsList := make([]string, len(*cliArgs))
+	for i, arg := range *cliArgs {
+		if argStr, ok := arg.(*StringValue); ok {
+			argsList[i] = argStr.stringContent()
+		} else {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("Mismatched types in call spawn, arguments must be strings in %s", cliArgs),
+			}
+		}
+	}
+
+	cmd := exec.CommandContext(c.eng.goContext(), path.stringContent(), argsList...)
+	switch dir := options["dir"].(type) {
+	case nil, NullValue:
+	case *StringValue:
+		cmd.Dir = dir.stringContent()
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call spawn, dir must be a string, got %s", dir),
+		}
+	}
+	switch env := options["env"].(type) {
+	case nil, NullValue:
+	case ObjectValue:
+		cmd.Env = os.Environ()
+		for name, val := range env {
+			valStr, ok := val.(*StringValue)
+			if !ok {
+				return nil, &RuntimeError{
+					reason: fmt.Sprintf("Mismatched types in call spawn, env values must be strings in %s", env),
+				}
+			}
+			cmd.Env = append(cmd.Env, name+"="+valStr.stringContent())
+		}
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call spawn, env must be an object, got %s", env),
+		}
+	}
+	return cmd, nil
+}
+
+// oakSpawn starts a child process and returns a handle to it right away. The
+// callback receives :stdout and :stderr events as the child writes output,
+// and then an :end event with its exit status once it exits and all of its
+// output has been delivered.
+func (c *Context) oakSpawn(args []Value) (Value, *RuntimeError) {
+	if len(args) == 3 {
+		args = []Value{args[0], args[1], null, args[2]}
+	}
+	if err := c.requireArgLen("spawn", args, 4); err != nil {
+		return nil, err
+	}
+	if denied := c.deny("spawn", c.policy.Exec); denied != nil {
+		return denied, nil
+	}
+
+	cmd, err := spawnCmd(c, args)
+	if err != nil {
+		return nil, err
+	}
+	callback, ok := args[3].(FnValue)
+	if !ok {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call spawn, callback must be a function, got %s", args[3]),
+		}
+	}
+
+	stdinPipe, stdinErr := cmd.StdinPipe()
+	stdoutPipe, stdoutErr := cmd.StdoutPipe()
+	stderrPipe, stderrErr := cmd.StderrPipe()
+	for _, err := range []error{stdinErr, stdoutErr, stderrErr} {
+		if err != nil {
+			return errObj(fmt.Sprintf("Could not start command in spawn(): %s", err.Error())), nil
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return errObj(fmt.Sprintf("Could not start command in spawn(): %s", err.Error())), nil
+	}
+
+	// the child may exit without reading all of its input, which is not an
+	// error, so failed writes are dropped
+	stdin := newWriteQueue()
+	go stdin.run(stdinPipe, nil)
+
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+
+		var streams sync.WaitGroup
+		stream := func(r io.Reader, evtType string) {
+			defer streams.Done()
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := r.Read(buf)
+				if n > 0 {
+					data := StringValue(append([]byte{}, buf[:n]...))
+					c.sendEvent(callback, ObjectValue{
+						"type": AtomValue(evtType),
+						"data": &data,
+					})
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+		streams.Add(2)
+		go stream(stdoutPipe, "stdout")
+		go stream(stderrPipe, "stderr")
+		streams.Wait()
+
+		status := exitStatus(cmd.Wait())
+		stdin.push(nil, true)
+		c.sendEvent(callback, ObjectValue{
+			"type":   AtomValue("end"),
+			"status": IntValue(status),
+		})
+	}()
+
+	return ObjectValue{
+		"type": AtomValue("process"),
+		"pid":  IntValue(cmd.Process.Pid),
+		"write": MakeBuiltinFn("write", func(args []Value) (Value, *RuntimeError) {
+			if err := c.requireArgLen("spawn/write", args, 1); err != nil {
+				return nil, err
+			}
+			data, ok := args[0].(*StringValue)
+			if !ok {
+				return nil, &RuntimeError{
+					reason: fmt.Sprintf("Mismatched types in call spawn/write(%s)", args[0]),
+				}
+			}
+			if !stdin.push(append([]byte{}, *data...), false) {
+				return errObj("Could not write to process in spawn(), stdin is closed"), nil
+			}
+			return null, nil
+		}),
+		"close": MakeBuiltinFn("close", func(_ []Value) (Value, *RuntimeError) {
+			stdin.push(nil, true)
+			return null, nil
+		}),
+		"kill": MakeBuiltinFn("kill", func(args []Value) (Value, *RuntimeError) {
+			var sig os.Signal = syscall.SIGTERM
+			if len(args) > 0 {
+				name, ok := args[0].(*StringValue)
+				if !ok {
+					return nil, &RuntimeError{
+						reason: fmt.Sprintf("Mismatched types in call spawn/kill(%s)", args[0]),
+					}
+				}
+				if sig, ok = killSignals[name.stringContent()]; !ok {
+					return errObj(fmt.Sprintf("Unknown signal %s", name.stringContent())), nil
+				}
+			}
+			if err := cmd.Process.Signal(sig); err != nil {
+				return errObj(fmt.Sprintf("Could not kill process in spawn(): %s", err.Error())), nil
+			}
+			return null, nil
+		}),
+	}, nil
+}
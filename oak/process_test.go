@@ -0,0 +1,140 @@
+//go:build !windows
+// +build !windows
+
+package oak
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSpawnStreamsStdio(t *testing.T) {
+	dir := t.TempDir()
+
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	_, err := ctx.Eval(strings.NewReader(fmt.Sprintf(`
+	stdout := ''
+	stderr := ''
+	events := []
+	proc := spawn('sh', ['-c', 'cat; echo "$GREETING" from "$(pwd)"; echo oops >&2; exit 3'], {
+		dir: '%s'
+		env: { GREETING: 'hello' }
+	}, fn(evt) if evt.type {
+		:stdout -> stdout << evt.data
+		:stderr -> stderr << evt.data
+		_ -> events << evt
+	})
+	proc.write('line 1\n')
+	proc.write('line 2\n')
+	proc.close()
+	afterClose := proc.write('line 3\n').type
+	[proc.type, type(proc.pid)]
+	`, dir)))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	vals := map[string]Value{}
+	for _, name := range []string{"stdout", "stderr", "events", "afterClose"} {
+		vals[name], _ = ctx.Get(name)
+	}
+	expected := map[string]Value{
+		"stdout":     MakeString(fmt.Sprintf("line 1\nline 2\nhello from %s\n", dir)),
+		"stderr":     MakeString("oops\n"),
+		"events":     MakeList(ObjectValue{"type": AtomValue("end"), "status": IntValue(3)}),
+		"afterClose": AtomValue("error"),
+	}
+	for name, val := range expected {
+		if !vals[name].Eq(val) {
+			t.Errorf("Expected %s to be %s, got %s", name, val, vals[name])
+		}
+	}
+}
+
+func TestSpawnKill(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	_, err := ctx.Eval(strings.NewReader(`
+	status := ?
+	proc := spawn('sleep', ['30'], fn(evt) if evt.type = :end -> status <- evt.status)
+	killed := [proc.kill('SIGBOGUS').type, proc.kill('SIGKILL')]
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	ctx.Wait()
+
+	killed, _ := ctx.Get("killed")
+	if expected := MakeList(AtomValue("error"), null); !killed.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, killed)
+	}
+	status, _ := ctx.Get("status")
+	if !status.Eq(IntValue(-1)) {
+		t.Errorf("Expected killed process to end with status -1, got %s", status)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 3").Run()
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{nil, 0},
+		{exitErr, 3},
+		{errors.New("exec: copying output failed"), -1},
+	} {
+		if status := exitStatus(tc.err); status != tc.status {
+			t.Errorf("Expected exit status %d for %v, got %d", tc.status, tc.err, status)
+		}
+	}
+}
+
+func TestReadFIFO(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "fifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		w, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		defer w.Close()
+		w.Write([]byte("first\nsecond\n"))
+	}()
+
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+	val, err := ctx.Eval(strings.NewReader(fmt.Sprintf(`
+	file := open('%s', :readonly)
+	[
+		read(file.fd, ?, '\n').data
+		read(file.fd, ?, 3).data
+		read(file.fd, ?, 10).data
+		read(file.fd, ?, 10).type
+		read(file.fd, 0, 10).type
+	]
+	`, fifo)))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	expected := MakeList(
+		MakeString("first\n"),
+		MakeString("sec"),
+		MakeString("ond\n"),
+		AtomValue("eof"),
+		AtomValue("error"),
+	)
+	if !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+}
@@ -0,0 +1,182 @@
+package oak
+
+// The resolver gives every local variable in an Oak program a slot in the
+// call frame of the function that declares it, so that the VM can read and
+// write variables by (depth, index) rather than by name. Blocks do not get
+// frames of their own: since Oak has no loops, every block runs at most once
+// per function call, and its variables can share the enclosing function's
+// frame.
+//
+// Oak variables are visible from the moment they are assigned, so the same
+// name may refer to different variables at different times. For example, in
+// { y := x, x := 2 } the first x refers to a variable in some outer scope. To
+// preserve this, each reference resolves to every enclosing declaration of
+// the name, innermost first, and the VM uses the first one that has been
+// assigned. Names not declared in any enclosing function or block are looked
+// up by name in the global (top-level) scope of the program.
+
+// varAddr is the address of a variable slot, depth call frames up from the
+// current one.
+type varAddr struct {
+	depth int
+	index int
+}
+
+type varRef struct {
+	name  string
+	addrs []varAddr
+}
+
+// lexScope is a function or block scope in the program source.
+type lexScope struct {
+	parent *lexScope
+	// compiler for the function whose call frame holds this scope's slots
+	owner *compiler
+	slots map[string]int
+}
+
+func (cmp *compiler) pushScope() *lexScope {
+	sc := &lexScope{
+		parent: cmp.scope,
+		owner:  cmp,
+		slots:  map[string]int{},
+	}
+	cmp.scope = sc
+	return sc
+}
+
+func (cmp *compiler) popScope() {
+	cmp.scope = cmp.scope.parent
+}
+
+// declare reserves a slot for name in the scope, if one does not exist.
+func (sc *lexScope) declare(name string) int {
+	if idx, ok := sc.slots[name]; ok {
+		return idx
+	}
+
+	idx := sc.owner.proto.slots
+	sc.slots[name] = idx
+	sc.owner.proto.slots++
+	return idx
+}
+
+// declareAll declares every variable that node assigns to in the scope that
+// contains it. Function literals and blocks introduce their own scopes, so
+// declareAll does not look inside them.
+func (sc *lexScope) declareAll(node astNode) {
+	switch n := node.(type) {
+	case listNode:
+		for _, el := range n.elems {
+			sc.declareAll(el)
+		}
+	case objectNode:
+		for _, entry := range n.entries {
+			sc.declareAll(entry.key)
+			sc.declareAll(entry.val)
+		}
+	case fnNode:
+		if n.name != "" {
+			sc.declare(n.name)
+		}
+	case assignmentNode:
+		if n.isLocal {
+			switch left := n.left.(type) {
+			case identifierNode:
+				sc.declare(left.payload)
+			case listNode:
+				for _, el := range left.elems {
+					if ident, ok := el.(identifierNode); ok {
+						sc.declare(ident.payload)
+					}
+				}
+			case objectNode:
+				for _, entry := range left.entries {
+					sc.declareAll(entry.key)
+					if ident, ok := entry.val.(identifierNode); ok {
+						sc.declare(ident.payload)
+					}
+				}
+			default:
+				sc.declareAll(left)
+			}
+		} else {
+			sc.declareAll(n.left)
+		}
+		sc.declareAll(n.right)
+	case propertyAccessNode:
+		sc.declareAll(n.left)
+		sc.declareAll(n.right)
+	case unaryNode:
+		sc.declareAll(n.right)
+	case binaryNode:
+		sc.declareAll(n.left)
+		sc.declareAll(n.right)
+	case fnCallNode:
+		sc.declareAll(n.fn)
+		for _, arg := range n.args {
+			sc.declareAll(arg)
+		}
+		if n.restArg != nil {
+			sc.declareAll(n.restArg)
+		}
+	case ifExprNode:
+		sc.declareAll(n.cond)
+		for _, branch := range n.branches {
+			sc.declareAll(branch.target)
+			sc.declareAll(branch.body)
+		}
+	}
+}
+
+// resolve finds every declaration of name visible from the current scope,
+// innermost first.
+func (cmp *compiler) resolve(name string) varRef {
+	ref := varRef{name: name}
+	for sc := cmp.scope; sc != nil; sc = sc.parent {
+		idx, ok := sc.slots[name]
+		if !ok {
+			continue
+		}
+
+		depth := 0
+		for owner := cmp; owner != sc.owner; owner = owner.parent {
+			depth++
+		}
+		ref.addrs = append(ref.addrs, varAddr{depth: depth, index: idx})
+	}
+	return ref
+}
+
+// frame holds the local variables of a single function call. A nil slot has
+// not been assigned yet in this call.
+type frame struct {
+	slots  []Value
+	parent *frame
+}
+
+func (f *frame) at(addr varAddr) *Value {
+	for d := addr.depth; d > 0; d-- {
+		f = f.parent
+	}
+	return &f.slots[addr.index]
+}
+
+func (f *frame) get(ref varRef, globals *scope) (Value, *RuntimeError) {
+	for _, addr := range ref.addrs {
+		if v := *f.at(addr); v != nil {
+			return v, nil
+		}
+	}
+	return globals.get(ref.name)
+}
+
+func (f *frame) update(ref varRef, v Value, globals *scope) *RuntimeError {
+	for _, addr := range ref.addrs {
+		if slot := f.at(addr); *slot != nil {
+			*slot = v
+			return nil
+		}
+	}
+	return globals.update(ref.name, v)
+}
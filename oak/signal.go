@@ -0,0 +1,140 @@
+package oak
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// signals are the OS signals Oak programs may handle with signal(), by name.
+// Platforms may add more in signalsForPlatform.
+var signals = map[string]os.Signal{
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGTERM": syscall.SIGTERM,
+}
+
+// killSignals are the signals that may be sent to processes started with
+// spawn(), which include those that cannot be handled.
+var killSignals = map[string]os.Signal{
+	"SIGKILL": syscall.SIGKILL,
+}
+
+func init() {
+	for name, sig := range signalsForPlatform {
+		signals[name] = sig
+	}
+	for name, sig := range signals {
+		killSignals[name] = sig
+	}
+}
+
+// parseSignals returns the OS signals named by arg, which is a signal name
+// like 'SIGINT' or a list of them, or the first name that is not a signal.
+func parseSignals(arg Value) (sigs []os.Signal, unknown string, ok bool) {
+	var names []Value
+	switch arg := arg.(type) {
+	case *StringValue:
+		names = []Value{arg}
+	case *ListValue:
+		names = *arg
+	default:
+		return nil, "", false
+	}
+
+	for _, nameVal := range names {
+		name, ok := nameVal.(*StringValue)
+		if !ok {
+			return nil, "", false
+		}
+		sig, ok := signals[name.stringContent()]
+		if !ok && unknown == "" {
+			unknown = name.stringContent()
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, unknown, true
+}
+
+// oakSignal calls a callback with a signal event each time the process
+// receives one of the given signals, instead of letting the signal end the
+// process, until the returned handle is cancelled. Like a ticker, a registered
+// handler keeps the program running.
+func (c *Context) oakSignal(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("signal", args, 2); err != nil {
+		return nil, err
+	}
+
+	sigs, unknown, ok1 := parseSignals(args[0])
+	callback, ok2 := args[1].(FnValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call signal(%s, %s)", args[0], args[1]),
+		}
+	}
+	if denied := c.deny("signal", c.policy.Signal); denied != nil {
+		return denied, nil
+	}
+	if unknown != "" {
+		return errObj(fmt.Sprintf("Unknown signal %s", unknown)), nil
+	}
+
+	notify := make(chan os.Signal, 1)
+	signal.Notify(notify, sigs...)
+
+	// active is only accessed while holding the interpreter lock
+	active := true
+	stop := make(chan struct{})
+	goCtx := c.eng.goContext()
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+		defer signal.Stop(notify)
+
+		for {
+			select {
+			case sig := <-notify:
+				c.Lock()
+				if !active || goCtx.Err() != nil {
+					c.Unlock()
+					return
+				}
+				_, err := c.EvalFnValue(callback, ObjectValue{
+					"type":   AtomValue("signal"),
+					"signal": MakeString(signalName(sig)),
+				})
+				if err != nil && c.eng.canceled() == nil {
+					c.eng.asyncError(err)
+				}
+				c.Unlock()
+			case <-stop:
+				return
+			case <-goCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return ObjectValue{
+		"type": AtomValue("signal"),
+		"cancel": MakeBuiltinFn("cancel", func(_ []Value) (Value, *RuntimeError) {
+			if !active {
+				return oakFalse, nil
+			}
+			active = false
+			close(stop)
+			return oakTrue, nil
+		}),
+	}, nil
+}
+
+func signalName(sig os.Signal) string {
+	for name, s := range signals {
+		if s == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
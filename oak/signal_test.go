@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package oak
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSignalHandlers(t *testing.T) {
+	ctx := NewContext("/tmp")
+	ctx.LoadBuiltins()
+
+	val, err := ctx.Eval(strings.NewReader(`
+	received := []
+	handler := signal(['SIGUSR1', 'SIGUSR2'], fn(evt) {
+		received << evt.signal
+		if len(received) = 2 -> handler.cancel()
+	})
+	[signal('SIGBOGUS', fn {}).type, handler.type]
+	`))
+	if err != nil {
+		t.Fatalf("Did not expect program to exit with error: %s", err.Error())
+	}
+	if expected := MakeList(AtomValue("error"), AtomValue("signal")); !val.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, val)
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		ctx.Wait()
+		close(waited)
+	}()
+
+	for _, sig := range []syscall.Signal{syscall.SIGUSR1, syscall.SIGUSR2} {
+		select {
+		case <-waited:
+			t.Fatalf("Expected a registered signal handler to keep the program running")
+		case <-time.After(50 * time.Millisecond):
+		}
+		if err := syscall.Kill(syscall.Getpid(), sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a cancelled signal handler not to keep the program running")
+	}
+
+	received, _ := ctx.Get("received")
+	if expected := MakeList(MakeString("SIGUSR1"), MakeString("SIGUSR2")); !received.Eq(expected) {
+		t.Errorf("Expected %s, got %s", expected, received)
+	}
+}
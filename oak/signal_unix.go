@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package oak
+
+import (
+	"os"
+	"syscall"
+)
+
+var signalsForPlatform = map[string]os.Signal{
+	"SIGUSR1":  syscall.SIGUSR1,
+	"SIGUSR2":  syscall.SIGUSR2,
+	"SIGWINCH": syscall.SIGWINCH,
+}
@@ -0,0 +1,5 @@
+package oak
+
+import "os"
+
+var signalsForPlatform = map[string]os.Signal{}
@@ -0,0 +1,364 @@
+package oak
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// sendEvent calls an Oak callback from the event loop with evt, reporting
+// any error as an asynchronous error.
+func (c *Context) sendEvent(callback Value, evt Value) {
+	c.Lock()
+	defer c.Unlock()
+	if _, err := c.EvalFnValue(callback, evt); err != nil && c.eng.canceled() == nil {
+		c.eng.asyncError(err)
+	}
+}
+
+// startConn returns the Oak handle for a connection, and calls callback with
+// a :connect event for it, then a :data event for each chunk of data it
+// receives, and finally an :end event once either side closes it or an
+// :error event if it fails. Writes are queued, and closing the connection
+// closes it once queued writes are done, as does the other side closing it.
+func (c *Context) startConn(conn net.Conn, callback Value) ObjectValue {
+	// closed when the program closes the connection or writing to it fails,
+	// so that the error from reading a closed connection can be told apart
+	// from a failure
+	closing := make(chan struct{})
+	var closeOnce sync.Once
+
+	goCtx := c.eng.goContext()
+	var handle ObjectValue
+	writes := newWriteQueue()
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+		writes.run(conn, func(err error) {
+			closeOnce.Do(func() { close(closing) })
+			if goCtx.Err() == nil {
+				c.sendEvent(callback, ObjectValue{
+					"type":  AtomValue("error"),
+					"conn":  handle,
+					"error": MakeString(fmt.Sprintf("Error writing to connection: %s", err.Error())),
+				})
+			}
+		})
+	}()
+
+	handle = ObjectValue{
+		"type":   AtomValue("conn"),
+		"local":  MakeString(conn.LocalAddr().String()),
+		"remote": MakeString(conn.RemoteAddr().String()),
+		"write": MakeBuiltinFn("write", func(args []Value) (Value, *RuntimeError) {
+			if err := c.requireArgLen("conn/write", args, 1); err != nil {
+				return nil, err
+			}
+			data, ok := args[0].(*StringValue)
+			if !ok {
+				return nil, &RuntimeError{
+					reason: fmt.Sprintf("Mismatched types in call conn/write(%s)", args[0]),
+				}
+			}
+			if !writes.push(append([]byte{}, *data...), false) {
+				return errObj("Could not write to connection, it is closed"), nil
+			}
+			return null, nil
+		}),
+		"close": MakeBuiltinFn("close", func(_ []Value) (Value, *RuntimeError) {
+			closeOnce.Do(func() { close(closing) })
+			writes.push(nil, true)
+			return null, nil
+		}),
+	}
+
+	done := make(chan struct{})
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+		defer close(done)
+		// once reading ends, finish queued writes and close the connection
+		defer writes.push(nil, true)
+
+		c.sendEvent(callback, ObjectValue{
+			"type": AtomValue("connect"),
+			"conn": handle,
+		})
+
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				data := StringValue(append([]byte{}, buf[:n]...))
+				c.sendEvent(callback, ObjectValue{
+					"type": AtomValue("data"),
+					"conn": handle,
+					"data": &data,
+				})
+			}
+			if err == nil {
+				continue
+			}
+
+			select {
+			case <-closing:
+				err = nil
+			default:
+			}
+			if err == nil || errors.Is(err, io.EOF) {
+				c.sendEvent(callback, ObjectValue{
+					"type": AtomValue("end"),
+					"conn": handle,
+				})
+			} else if goCtx.Err() == nil {
+				c.sendEvent(callback, ObjectValue{
+					"type":  AtomValue("error"),
+					"conn":  handle,
+					"error": MakeString(fmt.Sprintf("Error reading from connection: %s", err.Error())),
+				})
+			}
+			return
+		}
+	}()
+
+	// tear down the connection if the engine's Go context ends first
+	go func() {
+		select {
+		case <-goCtx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	return handle
+}
+
+func (c *Context) oakTCPListen(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("tcpListen", args, 2); err != nil {
+		return nil, err
+	}
+
+	addr, ok1 := args[0].(*StringValue)
+	callback, ok2 := args[1].(FnValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call tcpListen(%s, %s)", args[0], args[1]),
+		}
+	}
+	if denied := c.deny("tcpListen", c.policy.NetServer); denied != nil {
+		return denied, nil
+	}
+
+	ln, err := net.Listen("tcp", addr.stringContent())
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not listen in tcpListen(): %s", err.Error())), nil
+	}
+
+	closing := make(chan struct{})
+	var closeOnce sync.Once
+	goCtx := c.eng.goContext()
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+		// how long to wait before accepting again after a temporary error
+		var retryDelay time.Duration
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				select {
+				case <-closing:
+					return
+				default:
+				}
+				if goCtx.Err() != nil {
+					return
+				}
+				c.sendEvent(callback, errObj(fmt.Sprintf("Could not accept connection in tcpListen(): %s", err.Error())))
+
+				if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+					if retryDelay == 0 {
+						retryDelay = 5 * time.Millisecond
+					} else {
+						retryDelay *= 2
+					}
+					if retryDelay > time.Second {
+						retryDelay = time.Second
+					}
+					select {
+					case <-time.After(retryDelay):
+					case <-closing:
+						return
+					case <-goCtx.Done():
+						return
+					}
+					continue
+				}
+				return
+			}
+			retryDelay = 0
+			c.startConn(conn, callback)
+		}
+	}()
+
+	// tear down the listener if the engine's Go context ends first
+	go func() {
+		select {
+		case <-goCtx.Done():
+			ln.Close()
+		case <-closing:
+		}
+	}()
+
+	return ObjectValue{
+		"type": AtomValue("listener"),
+		"addr": MakeString(ln.Addr().String()),
+		"close": MakeBuiltinFn("close", func(_ []Value) (Value, *RuntimeError) {
+			closeOnce.Do(func() {
+				close(closing)
+				ln.Close()
+			})
+			return null, nil
+		}),
+	}, nil
+}
+
+func (c *Context) oakTCPDial(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("tcpDial", args, 2); err != nil {
+		return nil, err
+	}
+
+	addr, ok1 := args[0].(*StringValue)
+	callback, ok2 := args[1].(FnValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call tcpDial(%s, %s)", args[0], args[1]),
+		}
+	}
+	if denied := c.deny("tcpDial", c.policy.NetClient); denied != nil {
+		return denied, nil
+	}
+
+	goCtx := c.eng.goContext()
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(goCtx, "tcp", addr.stringContent())
+		if err != nil {
+			if goCtx.Err() == nil {
+				c.sendEvent(callback, errObj(fmt.Sprintf("Could not connect in tcpDial(): %s", err.Error())))
+			}
+			return
+		}
+		c.startConn(conn, callback)
+	}()
+
+	return null, nil
+}
+
+// maxDatagramSize is the size of the largest UDP datagram udpListen() can
+// receive in full.
+const maxDatagramSize = 64 * 1024
+
+func (c *Context) oakUDPListen(args []Value) (Value, *RuntimeError) {
+	if err := c.requireArgLen("udpListen", args, 2); err != nil {
+		return nil, err
+	}
+
+	addr, ok1 := args[0].(*StringValue)
+	callback, ok2 := args[1].(FnValue)
+	if !ok1 || !ok2 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call udpListen(%s, %s)", args[0], args[1]),
+		}
+	}
+	if denied := c.deny("udpListen", c.policy.NetServer); denied != nil {
+		return denied, nil
+	}
+
+	pc, err := net.ListenPacket("udp", addr.stringContent())
+	if err != nil {
+		return errObj(fmt.Sprintf("Could not listen in udpListen(): %s", err.Error())), nil
+	}
+
+	closing := make(chan struct{})
+	var closeOnce sync.Once
+	goCtx := c.eng.goContext()
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				select {
+				case <-closing:
+					return
+				default:
+				}
+				if goCtx.Err() == nil {
+					c.sendEvent(callback, errObj(fmt.Sprintf("Could not receive in udpListen(): %s", err.Error())))
+				}
+				return
+			}
+
+			data := StringValue(append([]byte{}, buf[:n]...))
+			c.sendEvent(callback, ObjectValue{
+				"type": AtomValue("data"),
+				"data": &data,
+				"from": MakeString(from.String()),
+			})
+		}
+	}()
+
+	// tear down the socket if the engine's Go context ends first
+	go func() {
+		select {
+		case <-goCtx.Done():
+			pc.Close()
+		case <-closing:
+		}
+	}()
+
+	return ObjectValue{
+		"type": AtomValue("udp"),
+		"addr": MakeString(pc.LocalAddr().String()),
+		"send": MakeBuiltinFn("send", func(args []Value) (Value, *RuntimeError) {
+			if err := c.requireArgLen("udp/send", args, 2); err != nil {
+				return nil, err
+			}
+			to, ok1 := args[0].(*StringValue)
+			data, ok2 := args[1].(*StringValue)
+			if !ok1 || !ok2 {
+				return nil, &RuntimeError{
+					reason: fmt.Sprintf("Mismatched types in call udp/send(%s, %s)", args[0], args[1]),
+				}
+			}
+			if denied := c.deny("udp/send", c.policy.NetClient); denied != nil {
+				return denied, nil
+			}
+
+			toAddr, err := net.ResolveUDPAddr("udp", to.stringContent())
+			if err != nil {
+				return errObj(fmt.Sprintf("Could not resolve address in udp/send: %s", err.Error())), nil
+			}
+			if _, err := pc.WriteTo(*data, toAddr); err != nil {
+				return errObj(fmt.Sprintf("Could not send in udp/send: %s", err.Error())), nil
+			}
+			return ObjectValue{
+				"type": AtomValue("end"),
+			}, nil
+		}),
+		"close": MakeBuiltinFn("close", func(_ []Value) (Value, *RuntimeError) {
+			closeOnce.Do(func() {
+				close(closing)
+				pc.Close()
+			})
+			return null, nil
+		}),
+	}, nil
+}
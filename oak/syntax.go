@@ -0,0 +1,328 @@
+package oak
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// This file exposes the Go tokenizer and parser to Oak programs, for use by
+// lib/syntax.oak. Tokens and AST nodes are converted to Oak objects of the
+// same shape that the Oak implementation of the library used to produce.
+
+var tokKindNames = [...]string{
+	unknown:        "unknown",
+	comment:        "comment",
+	newline:        "newline",
+	comma:          "comma",
+	dot:            "dot",
+	leftParen:      "leftParen",
+	rightParen:     "rightParen",
+	leftBracket:    "leftBracket",
+	rightBracket:   "rightBracket",
+	leftBrace:      "leftBrace",
+	rightBrace:     "rightBrace",
+	assign:         "assign",
+	nonlocalAssign: "nonlocalAssign",
+	pipeArrow:      "pipeArrow",
+	branchArrow:    "branchArrow",
+	pushArrow:      "pushArrow",
+	colon:          "colon",
+	ellipsis:       "ellipsis",
+	qmark:          "qmark",
+	exclam:         "exclam",
+	plus:           "plus",
+	minus:          "minus",
+	times:          "times",
+	divide:         "divide",
+	modulus:        "modulus",
+	xor:            "xor",
+	and:            "and",
+	or:             "or",
+	greater:        "greater",
+	less:           "less",
+	eq:             "eq",
+	geq:            "geq",
+	leq:            "leq",
+	neq:            "neq",
+	ifKeyword:      "ifKeyword",
+	fnKeyword:      "fnKeyword",
+	withKeyword:    "withKeyword",
+	underscore:     "underscore",
+	identifier:     "identifier",
+	trueLiteral:    "trueLiteral",
+	falseLiteral:   "falseLiteral",
+	stringLiteral:  "stringLiteral",
+	numberLiteral:  "numberLiteral",
+}
+
+func tokKindNamed(name string) (tokKind, bool) {
+	for kind, kindName := range tokKindNames {
+		if kindName == name {
+			return tokKind(kind), true
+		}
+	}
+	return unknown, false
+}
+
+// syntaxEncoder converts tokens and AST nodes into Oak values. Oak strings are
+// byte strings, so positions in Oak values are byte offsets and columns.
+type syntaxEncoder struct {
+	// byte offset of each rune in the source text, or nil if positions are
+	// already in bytes because they came from Oak tokens
+	byteOffsets []int
+}
+
+func newSyntaxEncoder(source []rune) syntaxEncoder {
+	byteOffsets := make([]int, len(source)+1)
+	for i, r := range source {
+		byteOffsets[i+1] = byteOffsets[i] + utf8.RuneLen(r)
+	}
+	return syntaxEncoder{byteOffsets: byteOffsets}
+}
+
+func (e syntaxEncoder) pos(p pos) Value {
+	offset, col := p.offset, p.col
+	if e.byteOffsets != nil && offset >= 0 && offset < len(e.byteOffsets) {
+		lineStart := offset - (col - 1)
+		if lineStart < 0 {
+			lineStart = 0
+		}
+		offset, col = e.byteOffsets[offset], e.byteOffsets[offset]-e.byteOffsets[lineStart]+1
+	}
+	return MakeList(IntValue(offset), IntValue(p.line), IntValue(col))
+}
+
+func (e syntaxEncoder) token(t token) Value {
+	var val Value = null
+	switch t.kind {
+	case comment, identifier, stringLiteral, numberLiteral:
+		val = MakeString(t.payload)
+	}
+	return ObjectValue{
+		"type": AtomValue(tokKindNames[t.kind]),
+		"val":  val,
+		"pos":  e.pos(t.pos),
+	}
+}
+
+func (e syntaxEncoder) tokens(tokens []token) Value {
+	vals := make(ListValue, len(tokens))
+	for i, tok := range tokens {
+		vals[i] = e.token(tok)
+	}
+	return &vals
+}
+
+func (e syntaxEncoder) nodes(nodes []astNode) Value {
+	vals := make(ListValue, len(nodes))
+	for i, node := range nodes {
+		vals[i] = e.node(node)
+	}
+	return &vals
+}
+
+func (e syntaxEncoder) node(node astNode) Value {
+	switch n := node.(type) {
+	case emptyNode:
+		return ObjectValue{
+			"type": AtomValue("empty"),
+			"tok":  e.token(*n.tok),
+		}
+	case nullNode:
+		return ObjectValue{
+			"type": AtomValue("null"),
+			"tok":  e.token(*n.tok),
+		}
+	case stringNode:
+		return ObjectValue{
+			"type": AtomValue("string"),
+			"tok":  e.token(*n.tok),
+			"val":  MakeString(string(n.payload)),
+		}
+	case intNode:
+		return ObjectValue{
+			"type": AtomValue("int"),
+			"tok":  e.token(*n.tok),
+			"val":  IntValue(n.payload),
+		}
+	case floatNode:
+		return ObjectValue{
+			"type": AtomValue("float"),
+			"tok":  e.token(*n.tok),
+			"val":  FloatValue(n.payload),
+		}
+	case boolNode:
+		return ObjectValue{
+			"type": AtomValue("bool"),
+			"tok":  e.token(*n.tok),
+			"val":  BoolValue(n.payload),
+		}
+	case atomNode:
+		return ObjectValue{
+			"type": AtomValue("atom"),
+			"tok":  e.token(*n.tok),
+			"val":  MakeString(n.payload),
+		}
+	case listNode:
+		return ObjectValue{
+			"type":  AtomValue("list"),
+			"tok":   e.token(*n.tok),
+			"elems": e.nodes(n.elems),
+		}
+	case objectNode:
+		entries := make(ListValue, len(n.entries))
+		for i, entry := range n.entries {
+			entries[i] = ObjectValue{
+				"key": e.node(entry.key),
+				"val": e.node(entry.val),
+			}
+		}
+		return ObjectValue{
+			"type":    AtomValue("object"),
+			"tok":     e.token(*n.tok),
+			"entries": &entries,
+		}
+	case fnNode:
+		args := make(ListValue, len(n.args))
+		for i, arg := range n.args {
+			if arg == "" {
+				arg = "_"
+			}
+			args[i] = MakeString(arg)
+		}
+		return ObjectValue{
+			"type":    AtomValue("function"),
+			"name":    MakeString(n.name),
+			"tok":     e.token(*n.tok),
+			"args":    &args,
+			"restArg": MakeString(n.restArg),
+			"body":    e.node(n.body),
+		}
+	case identifierNode:
+		return ObjectValue{
+			"type": AtomValue("identifier"),
+			"tok":  e.token(*n.tok),
+			"val":  MakeString(n.payload),
+		}
+	case assignmentNode:
+		return ObjectValue{
+			"type":   AtomValue("assignment"),
+			"tok":    e.token(*n.tok),
+			"local?": BoolValue(n.isLocal),
+			"left":   e.node(n.left),
+			"right":  e.node(n.right),
+		}
+	case propertyAccessNode:
+		return ObjectValue{
+			"type":  AtomValue("propertyAccess"),
+			"tok":   e.token(*n.tok),
+			"left":  e.node(n.left),
+			"right": e.node(n.right),
+		}
+	case unaryNode:
+		return ObjectValue{
+			"type":  AtomValue("unary"),
+			"tok":   e.token(*n.tok),
+			"op":    AtomValue(tokKindNames[n.op]),
+			"right": e.node(n.right),
+		}
+	case binaryNode:
+		return ObjectValue{
+			"type":  AtomValue("binary"),
+			"tok":   e.token(*n.tok),
+			"op":    AtomValue(tokKindNames[n.op]),
+			"left":  e.node(n.left),
+			"right": e.node(n.right),
+		}
+	case fnCallNode:
+		var restArg Value = null
+		if n.restArg != nil {
+			restArg = e.node(n.restArg)
+		}
+		return ObjectValue{
+			"type":     AtomValue("fnCall"),
+			"function": e.node(n.fn),
+			"args":     e.nodes(n.args),
+			"restArg":  restArg,
+			"tok":      e.token(*n.tok),
+		}
+	case ifExprNode:
+		branches := make(ListValue, len(n.branches))
+		for i, branch := range n.branches {
+			branches[i] = ObjectValue{
+				"type":   AtomValue("ifBranch"),
+				"target": e.node(branch.target),
+				"body":   e.node(branch.body),
+			}
+		}
+		return ObjectValue{
+			"type":     AtomValue("ifExpr"),
+			"tok":      e.token(*n.tok),
+			"cond":     e.node(n.cond),
+			"branches": &branches,
+		}
+	case blockNode:
+		return ObjectValue{
+			"type":  AtomValue("block"),
+			"tok":   e.token(*n.tok),
+			"exprs": e.nodes(n.exprs),
+		}
+	}
+	panic(fmt.Sprintf("Unknown AST node %s", node))
+}
+
+// parseErrors encodes syntax errors as an error object for the first one,
+// with every error listed under errors.
+func (e syntaxEncoder) parseErrors(errs []ParseError) Value {
+	encoded := make(ListValue, len(errs))
+	for i, err := range errs {
+		encoded[i] = ObjectValue{
+			"error": MakeString(err.reason),
+			"pos":   e.pos(err.pos),
+		}
+	}
+	return ObjectValue{
+		"type":   AtomValue("error"),
+		"error":  MakeString(errs[0].reason),
+		"pos":    e.pos(errs[0].pos),
+		"errors": &encoded,
+	}
+}
+
+// decodeTokens converts a list of Oak token objects back into tokens,
+// dropping comment and newline tokens, which the parser does not accept.
+func decodeTokens(tokens *ListValue) ([]token, bool) {
+	decoded := make([]token, 0, len(*tokens))
+	for _, tokVal := range *tokens {
+		tokObj, ok := tokVal.(ObjectValue)
+		if !ok {
+			return nil, false
+		}
+
+		kindName, ok := tokObj["type"].(AtomValue)
+		if !ok {
+			return nil, false
+		}
+		kind, ok := tokKindNamed(string(kindName))
+		if !ok {
+			return nil, false
+		}
+		if kind == comment || kind == newline {
+			continue
+		}
+
+		tok := token{kind: kind}
+		if payload, ok := tokObj["val"].(*StringValue); ok {
+			tok.payload = payload.stringContent()
+		}
+		if position, ok := tokObj["pos"].(*ListValue); ok && len(*position) == 3 {
+			offset, _ := (*position)[0].(IntValue)
+			line, _ := (*position)[1].(IntValue)
+			col, _ := (*position)[2].(IntValue)
+			tok.pos = pos{line: int(line), col: int(col), offset: int(offset)}
+		}
+		tok.end = tok.pos
+		decoded = append(decoded, tok)
+	}
+	return decoded, true
+}
@@ -1,4 +1,4 @@
-package main
+package oak
 
 import (
 	"fmt"
@@ -10,28 +10,116 @@ import (
 type tokenizer struct {
 	source []rune
 	index  int
+	// lossless tokenizers also emit comment and newline tokens, which are
+	// not part of the syntax tree but are needed to reproduce the source
+	lossless bool
 
-	fileName string
-	line     int
-	col      int
+	file *sourceFile
+	line int
+	col  int
+}
+
+// sourceFile is the text of an Oak program, shared by every position in it so
+// that errors can quote the source they refer to.
+type sourceFile struct {
+	name string
+	text []rune
 }
 
 type pos struct {
-	fileName string
-	line     int
-	col      int
+	file *sourceFile
+	line int
+	col  int
+	// offset of the rune at this position from the start of the source
+	offset int
+}
+
+func (p pos) fileName() string {
+	if p.file == nil {
+		return ""
+	}
+	return p.file.name
 }
 
 func (p pos) String() string {
+	if name := p.fileName(); name != "" {
+		return fmt.Sprintf("[%s:%d:%d]", name, p.line, p.col)
+	}
 	return fmt.Sprintf("[%d:%d]", p.line, p.col)
 }
 
+// span is the range of source text covered by a token or AST node, from start
+// up to but not including end.
+type span struct {
+	start pos
+	end   pos
+}
+
+func (s span) loc() span {
+	return s
+}
+
+// excerpt quotes the line of source containing point, underlining the part of
+// the span that falls on that line and marking the point itself with a caret.
+// If the source is not known, excerpt returns an empty string.
+func (s span) excerpt(point pos) string {
+	if point.file == nil || point.line == 0 {
+		return ""
+	}
+	text := point.file.text
+	if point.offset < 0 || point.offset > len(text) {
+		return ""
+	}
+
+	lineStart := point.offset
+	for lineStart > 0 && text[lineStart-1] != '\n' {
+		lineStart--
+	}
+	lineEnd := point.offset
+	for lineEnd < len(text) && text[lineEnd] != '\n' {
+		lineEnd++
+	}
+
+	underlineStart, underlineEnd := point.offset, point.offset+1
+	if s.start.file == point.file && s.start.offset <= point.offset && point.offset < s.end.offset {
+		underlineStart, underlineEnd = s.start.offset, s.end.offset
+		if underlineStart < lineStart {
+			underlineStart = lineStart
+		}
+		if underlineEnd > lineEnd {
+			underlineEnd = lineEnd
+		}
+	}
+
+	marker := strings.Builder{}
+	for i := lineStart; i < underlineEnd; i++ {
+		switch {
+		case i == point.offset:
+			marker.WriteRune('^')
+		case i >= underlineStart:
+			marker.WriteRune('~')
+		case text[i] == '\t':
+			marker.WriteRune('\t')
+		default:
+			marker.WriteRune(' ')
+		}
+	}
+	if underlineEnd <= point.offset {
+		marker.WriteRune('^')
+	}
+
+	lineNo := strconv.Itoa(point.line)
+	gutter := strings.Repeat(" ", len(lineNo))
+	return fmt.Sprintf("%s | %s\n%s | %s", lineNo, string(text[lineStart:lineEnd]), gutter, marker.String())
+}
+
 type tokKind int
 
 const (
 	// sentinel
 	unknown tokKind = iota
 	comment
+	newline
 
 	// language tokens
 	comma
@@ -85,13 +173,20 @@ const (
 type token struct {
 	kind tokKind
 	pos
+	end     pos
 	payload string
 }
 
+func (t token) span() span {
+	return span{start: t.pos, end: t.end}
+}
+
 func (t token) String() string {
 	switch t.kind {
 	case comment:
 		return fmt.Sprintf("//(%s)", t.payload)
+	case newline:
+		return "newline"
 	case comma:
 		return ","
 	case dot:
@@ -178,20 +273,43 @@ func (t token) String() string {
 }
 
 func newTokenizer(sourceString string) tokenizer {
+	return newFileTokenizer("", sourceString)
+}
+
+// newFileTokenizer returns a tokenizer whose positions refer to the given file
+// name, to tell apart errors in different Oak source files.
+func newFileTokenizer(fileName string, sourceString string) tokenizer {
+	source := []rune(sourceString)
 	return tokenizer{
-		source:   []rune(sourceString),
-		index:    0,
-		fileName: "(input)",
-		line:     1,
-		col:      0,
+		source: source,
+		index:  0,
+		file: &sourceFile{
+			name: fileName,
+			text: source,
+		},
+		line: 1,
+		col:  0,
 	}
 }
 
+// currentPos returns the position of the last rune read.
 func (t *tokenizer) currentPos() pos {
 	return pos{
-		fileName: t.fileName,
-		line:     t.line,
-		col:      t.col,
+		file:   t.file,
+		line:   t.line,
+		col:    t.col,
+		offset: t.index - 1,
+	}
+}
+
+// endPos returns the position just past the last rune read, where a token
+// ending at the last rune read ends.
+func (t *tokenizer) endPos() pos {
+	return pos{
+		file:   t.file,
+		line:   t.line,
+		col:    t.col + 1,
+		offset: t.index,
 	}
 }
 
@@ -327,14 +445,17 @@ func (t *tokenizer) nextToken() token {
 		if !t.isEOF() {
 			switch t.peek() {
 			case '<':
+				pos := t.currentPos()
 				t.next()
-				return token{kind: pushArrow, pos: t.currentPos()}
+				return token{kind: pushArrow, pos: pos}
 			case '-':
+				pos := t.currentPos()
 				t.next()
-				return token{kind: nonlocalAssign, pos: t.currentPos()}
+				return token{kind: nonlocalAssign, pos: pos}
 			case '=':
+				pos := t.currentPos()
 				t.next()
-				return token{kind: leq, pos: t.currentPos()}
+				return token{kind: leq, pos: pos}
 			}
 		}
 		return token{kind: less, pos: t.currentPos()}
@@ -342,16 +463,18 @@ func (t *tokenizer) nextToken() token {
 		return token{kind: qmark, pos: t.currentPos()}
 	case '!':
 		if !t.isEOF() && t.peek() == '=' {
+			pos := t.currentPos()
 			t.next()
-			return token{kind: neq, pos: t.currentPos()}
+			return token{kind: neq, pos: pos}
 		}
 		return token{kind: exclam, pos: t.currentPos()}
 	case '+':
 		return token{kind: plus, pos: t.currentPos()}
 	case '-':
 		if !t.isEOF() && t.peek() == '>' {
+			pos := t.currentPos()
 			t.next()
-			return token{kind: branchArrow, pos: t.currentPos()}
+			return token{kind: branchArrow, pos: pos}
 		}
 		return token{kind: minus, pos: t.currentPos()}
 	case '*':
@@ -360,7 +483,7 @@ func (t *tokenizer) nextToken() token {
 		if !t.isEOF() && t.peek() == '/' {
 			pos := t.currentPos()
 			t.next()
-			commentString := strings.TrimSpace(t.readUntilRune('\n'))
+			commentString := strings.TrimRight(t.readUntilRune('\n'), " \t\r\f")
 			return token{
 				kind:    comment,
 				pos:     pos,
@@ -376,8 +499,9 @@ func (t *tokenizer) nextToken() token {
 		return token{kind: and, pos: t.currentPos()}
 	case '|':
 		if !t.isEOF() && t.peek() == '>' {
+			pos := t.currentPos()
 			t.next()
-			return token{kind: pipeArrow, pos: t.currentPos()}
+			return token{kind: pipeArrow, pos: pos}
 		}
 		return token{kind: or, pos: t.currentPos()}
 	case '>':
@@ -448,6 +572,15 @@ func (t *tokenizer) nextToken() token {
 	}
 }
 
+// newlineToken returns a token for the newline that is the next rune.
+func (t *tokenizer) newlineToken() token {
+	pos := t.endPos()
+	end := pos
+	end.col++
+	end.offset++
+	return token{kind: newline, pos: pos, end: end}
+}
+
 func (t *tokenizer) tokenize() []token {
 	tokens := []token{}
 
@@ -461,12 +594,16 @@ func (t *tokenizer) tokenize() []token {
 
 	// snip whitespace before
 	for !t.isEOF() && unicode.IsSpace(t.peek()) {
+		if t.lossless && t.peek() == '\n' {
+			tokens = append(tokens, t.newlineToken())
+		}
 		t.next()
 	}
 
 	last := token{kind: comma}
 	for !t.isEOF() {
 		next := t.nextToken()
+		next.end = t.endPos()
 
 		if (last.kind != leftParen && last.kind != leftBracket &&
 			last.kind != leftBrace && last.kind != comma) &&
@@ -474,14 +611,15 @@ func (t *tokenizer) tokenize() []token {
 				next.kind == rightBrace) {
 			tokens = append(tokens, token{
 				kind: comma,
-				pos:  t.currentPos(),
+				pos:  next.pos,
 			})
 		}
 
+		if next.kind != comment || t.lossless {
+			tokens = append(tokens, next)
+		}
 		if next.kind == comment {
 			next = last
-		} else {
-			tokens = append(tokens, next)
 		}
 
 		// snip whitespace after
@@ -496,10 +634,13 @@ func (t *tokenizer) tokenize() []token {
 				default:
 					next = token{
 						kind: comma,
-						pos:  t.currentPos(),
+						pos:  t.endPos(),
 					}
 					tokens = append(tokens, next)
 				}
+				if t.lossless {
+					tokens = append(tokens, t.newlineToken())
+				}
 			}
 			t.next()
 		}
@@ -512,7 +653,7 @@ func (t *tokenizer) tokenize() []token {
 	if last.kind != comma {
 		tokens = append(tokens, token{
 			kind: comma,
-			pos:  t.currentPos(),
+			pos:  t.endPos(),
 		})
 	}
 
@@ -0,0 +1,680 @@
+package oak
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// callFrame is the state of a single invocation of a compiled fnProto on the
+// VM's call stack.
+type callFrame struct {
+	proto *fnProto
+	// index of the next instruction to execute
+	ip int
+	// index into the VM's operand stack where this frame's operands begin
+	base    int
+	env     *frame
+	globals *scope
+}
+
+type vm struct {
+	ctx    *Context
+	stack  []Value
+	frames []callFrame
+
+	// closed when the Go context governing evaluation ends
+	done <-chan struct{}
+	// number of function calls made, used to check done periodically
+	calls int
+	// remaining fuel of the engine, or nil if evaluation is not metered
+	fuel *int64
+}
+
+// cancelCheckInterval is the number of function calls between checks for
+// whether evaluation has been canceled. Oak has no loops, so any long-running
+// program makes function calls regularly.
+const cancelCheckInterval = 256
+
+func newVM(c *Context) vm {
+	return vm{
+		ctx:  c,
+		done: c.eng.goContext().Done(),
+		fuel: c.eng.fuel,
+	}
+}
+
+func (m *vm) push(v Value) {
+	m.stack = append(m.stack, v)
+}
+
+func (m *vm) pop() Value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+func (m *vm) peek() Value {
+	return m.stack[len(m.stack)-1]
+}
+
+// popN pops the top n values off the operand stack into a new slice, so the
+// values are safe to retain after the stack is reused.
+func (m *vm) popN(n int) []Value {
+	top := len(m.stack) - n
+	vals := make([]Value, n)
+	copy(vals, m.stack[top:])
+	m.stack = m.stack[:top]
+	return vals
+}
+
+// runProgram evaluates a compiled top-level program with the given global
+// scope.
+func (c *Context) runProgram(proto *fnProto, globals scope) (Value, *RuntimeError) {
+	m := newVM(c)
+	m.frames = append(m.frames, callFrame{
+		proto: proto,
+		env: &frame{
+			slots: make([]Value, proto.slots),
+		},
+		globals: &globals,
+	})
+	return m.run()
+}
+
+// callFrameFor creates a call frame for a call to fn with the given
+// arguments, binding named arguments and any rest argument to their slots.
+func (m *vm) callFrameFor(fn FnValue, args []Value) callFrame {
+	proto := fn.proto
+	env := &frame{
+		slots:  make([]Value, proto.slots),
+		parent: fn.env,
+	}
+	for i, slot := range proto.argSlots {
+		if slot < 0 {
+			continue
+		}
+		// if not enough arguments, fill them with nulls
+		if i < len(args) {
+			env.slots[slot] = args[i]
+		} else {
+			env.slots[slot] = null
+		}
+	}
+
+	if proto.restSlot >= 0 {
+		var restList ListValue
+		if len(args) > len(proto.argSlots) {
+			restList = ListValue(args[len(proto.argSlots):])
+		} else {
+			restList = ListValue{}
+		}
+		env.slots[proto.restSlot] = &restList
+	}
+
+	return callFrame{
+		proto:   proto,
+		base:    len(m.stack),
+		env:     env,
+		globals: fn.globals,
+	}
+}
+
+// unwind annotates a runtime error raised in the current call frame with its
+// position and a stack trace of every active Oak function call on this VM.
+func (m *vm) unwind(err *RuntimeError) *RuntimeError {
+	fr := &m.frames[len(m.frames)-1]
+	if err.pos.line == 0 && fr.ip > 0 {
+		if src := fr.proto.src[fr.ip-1]; src != nil {
+			err.pos = src.pos()
+			err.span = src.loc()
+		}
+	}
+
+	for i := len(m.frames) - 1; i >= 0; i-- {
+		if defn := m.frames[i].proto.defn; defn != nil {
+			err.stackTrace = append(err.stackTrace, stackEntry{
+				name: defn.name,
+				pos:  defn.pos(),
+			})
+		}
+	}
+	return err
+}
+
+// call invokes the function value maybeFn with args. Calls to Oak functions
+// push a new call frame, or replace the current one if tail is set, and
+// return a nil Value. Calls to builtins return their result immediately, with
+// a nil result from a builtin returned as null, so that it is not mistaken
+// for a new call frame.
+func (m *vm) call(maybeFn Value, args []Value, tail bool) (Value, *RuntimeError) {
+	m.calls++
+	if m.done != nil && m.calls%cancelCheckInterval == 0 {
+		select {
+		case <-m.done:
+			return nil, m.ctx.eng.canceled()
+		default:
+		}
+	}
+
+	switch fn := maybeFn.(type) {
+	case FnValue:
+		frame := m.callFrameFor(fn, args)
+		if tail {
+			// a tail call reuses the current frame's place on the call stack
+			top := &m.frames[len(m.frames)-1]
+			m.stack = m.stack[:top.base]
+			frame.base = top.base
+			*top = frame
+		} else {
+			if len(m.frames) >= m.ctx.maxCallDepth {
+				return nil, &RuntimeError{
+					reason: fmt.Sprintf("Stack overflow, exceeded maximum call depth of %d", m.ctx.maxCallDepth),
+				}
+			}
+			m.frames = append(m.frames, frame)
+		}
+		return nil, nil
+	case BuiltinFnValue:
+		val, err := fn.fn(args)
+		if val == nil && err == nil {
+			val = null
+		}
+		return val, err
+	}
+
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("%s is not a function and cannot be called", maybeFn),
+	}
+}
+
+// spreadArgs pops a spread argument list and the given number of positional
+// arguments off of the stack.
+func (m *vm) spreadArgs(argc int, src astNode) ([]Value, *RuntimeError) {
+	rest := m.pop()
+	restList, ok := rest.(*ListValue)
+	if !ok {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Cannot spread a non-list value %s in a function call %s", rest, src),
+			pos:    src.pos(),
+		}
+	}
+
+	args := m.popN(argc)
+	return append(args, *restList...), nil
+}
+
+// run executes instructions until the bottom-most call frame on the VM
+// returns, and returns its result.
+func (m *vm) run() (Value, *RuntimeError) {
+	fr := &m.frames[len(m.frames)-1]
+	for {
+		if m.fuel != nil {
+			if *m.fuel <= 0 {
+				return nil, m.unwind(outOfFuelError())
+			}
+			*m.fuel--
+		}
+
+		in := fr.proto.code[fr.ip]
+		fr.ip++
+
+		var err *RuntimeError
+		switch in.op {
+		case opConst:
+			m.push(fr.proto.consts[in.arg])
+		case opString:
+			str := fr.proto.consts[in.arg].(*StringValue)
+			payload := make([]byte, len(*str))
+			copy(payload, *str)
+			v := StringValue(payload)
+			m.push(&v)
+		case opPop:
+			m.pop()
+		case opDup:
+			m.push(m.peek())
+		case opLoad:
+			var val Value
+			val, err = fr.env.get(fr.proto.refs[in.arg], fr.globals)
+			if err == nil {
+				m.push(val)
+			}
+		case opDefine:
+			fr.env.slots[in.arg] = m.peek()
+		case opDefineGlobal:
+			fr.globals.put(fr.proto.names[in.arg], m.peek())
+		case opUpdate:
+			err = fr.env.update(fr.proto.refs[in.arg], m.peek(), fr.globals)
+		case opList:
+			list := ListValue(m.popN(in.arg))
+			m.push(&list)
+		case opObjKey:
+			var key Value
+			key, err = objKey(m.pop())
+			if err == nil {
+				m.push(key)
+			}
+		case opObject:
+			entries := m.popN(in.arg * 2)
+			obj := make(ObjectValue, in.arg)
+			for i := 0; i < len(entries); i += 2 {
+				obj[string(*entries[i].(*StringValue))] = entries[i+1]
+			}
+			m.push(obj)
+		case opClosure:
+			m.push(FnValue{
+				proto:   fr.proto.protos[in.arg],
+				env:     fr.env,
+				globals: fr.globals,
+			})
+		case opGetProp:
+			right := m.pop()
+			left := m.pop()
+			var val Value
+			val, err = getProp(left, right)
+			if err == nil {
+				m.push(val)
+			}
+		case opSetProp:
+			right := m.pop()
+			left := m.pop()
+			assignedValue := m.pop()
+			err = setProp(left, right, assignedValue, fr.proto.src[fr.ip-1])
+			if err == nil {
+				m.push(left)
+			}
+		case opUnary:
+			var val Value
+			val, err = unaryOp(tokKind(in.arg), m.pop())
+			if err == nil {
+				m.push(val)
+			}
+		case opBinary:
+			right := m.pop()
+			left := m.pop()
+			var val Value
+			val, err = binaryOp(tokKind(in.arg), left, right)
+			if err == nil {
+				m.push(val)
+			}
+		case opJump:
+			fr.ip = in.arg
+		case opJumpIfTrue:
+			if b, ok := m.peek().(BoolValue); ok && bool(b) {
+				fr.ip = in.arg
+			}
+		case opJumpIfFalse:
+			if b, ok := m.peek().(BoolValue); ok && !bool(b) {
+				fr.ip = in.arg
+			}
+		case opMatch:
+			target := m.pop()
+			if m.peek().Eq(target) {
+				m.pop()
+			} else {
+				fr.ip = in.arg
+			}
+		case opCall, opCallSpread, opTailCall, opTailCallSpread:
+			var args []Value
+			if in.op == opCallSpread || in.op == opTailCallSpread {
+				args, err = m.spreadArgs(in.arg, fr.proto.src[fr.ip-1])
+			} else {
+				args = m.popN(in.arg)
+			}
+			if err != nil {
+				break
+			}
+
+			maybeFn := m.pop()
+			tail := in.op == opTailCall || in.op == opTailCallSpread
+			var val Value
+			val, err = m.call(maybeFn, args, tail)
+			if err != nil {
+				break
+			}
+
+			if val == nil {
+				// entered a new Oak function call frame
+				fr = &m.frames[len(m.frames)-1]
+				continue
+			}
+			m.push(val)
+			if !tail {
+				break
+			}
+			// a builtin in tail position returns its result directly
+			fallthrough
+		case opReturn:
+			val := m.pop()
+			m.stack = m.stack[:fr.base]
+			m.frames = m.frames[:len(m.frames)-1]
+			if len(m.frames) == 0 {
+				return val, nil
+			}
+			fr = &m.frames[len(m.frames)-1]
+			m.push(val)
+		case opCheckList:
+			if _, ok := m.peek().(*ListValue); !ok {
+				n := fr.proto.src[fr.ip-1].(assignmentNode)
+				err = &RuntimeError{
+					reason: fmt.Sprintf("right side %s of list destructuring is not a list", n.right),
+				}
+			}
+		case opCheckObject:
+			if _, ok := m.peek().(ObjectValue); !ok {
+				n := fr.proto.src[fr.ip-1].(assignmentNode)
+				err = &RuntimeError{
+					reason: fmt.Sprintf("right side %s of object destructuring is not an object", n.right),
+				}
+			}
+		case opIndex:
+			list := m.pop().(*ListValue)
+			if in.arg < len(*list) {
+				m.push((*list)[in.arg])
+			} else {
+				m.push(null)
+			}
+		case opLookup:
+			key := m.pop()
+			obj := m.pop().(ObjectValue)
+			if val, ok := obj[objKeyString(key)]; ok {
+				m.push(val)
+			} else {
+				m.push(null)
+			}
+		case opError:
+			err = &RuntimeError{
+				reason: fr.proto.consts[in.arg].(*StringValue).stringContent(),
+			}
+		default:
+			panic(fmt.Sprintf("Unexpected opcode %d", in.op))
+		}
+
+		if err != nil {
+			return nil, m.unwind(err)
+		}
+	}
+}
+
+// objKey validates a computed object literal key and converts it to a string.
+func objKey(key Value) (Value, *RuntimeError) {
+	switch typedKey := key.(type) {
+	case *StringValue:
+		return typedKey, nil
+	case AtomValue:
+		return MakeString(string(typedKey)), nil
+	case IntValue, FloatValue:
+		return MakeString(typedKey.String()), nil
+	}
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("Expected a string, atom, or number as object key, got %s", key.String()),
+	}
+}
+
+// objKeyString converts a value used to access an object property into the
+// string key of the property.
+func objKeyString(key Value) string {
+	if k, ok := key.(*StringValue); ok {
+		return string(*k)
+	} else if k, ok := key.(AtomValue); ok {
+		return string(k)
+	}
+	return key.String()
+}
+
+func getProp(left, right Value) (Value, *RuntimeError) {
+	switch target := left.(type) {
+	case *StringValue:
+		byteIndex, ok := right.(IntValue)
+		if !ok {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("Cannot index into string with non-integer index %s", right),
+			}
+		}
+
+		if byteIndex < 0 || int64(byteIndex) >= int64(len(*target)) {
+			return null, nil
+		}
+
+		targetByte := StringValue([]byte{(*target)[byteIndex]})
+		return &targetByte, nil
+	case *ListValue:
+		listIndex, ok := right.(IntValue)
+		if !ok {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("Cannot index into list with non-integer index %s", right),
+			}
+		}
+
+		if listIndex < 0 || int64(listIndex) >= int64(len(*target)) {
+			return null, nil
+		}
+
+		return (*target)[listIndex], nil
+	case ObjectValue:
+		if val, ok := target[objKeyString(right)]; ok {
+			return val, nil
+		}
+
+		return null, nil
+	}
+
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("Expected string, list, or object in left-hand side of property access, got %s", left.String()),
+	}
+}
+
+func setProp(assignLeft, assignRight, assignedValue Value, n astNode) *RuntimeError {
+	switch target := assignLeft.(type) {
+	case *StringValue:
+		assignedString, ok := assignedValue.(*StringValue)
+		if !ok {
+			return &RuntimeError{
+				reason: fmt.Sprintf("Cannot assign non-string value %s to string in %s", assignedValue, n.(assignmentNode).left),
+			}
+		}
+
+		byteIndexVal, ok := assignRight.(IntValue)
+		if !ok {
+			return &RuntimeError{
+				reason: fmt.Sprintf("Cannot index into string with non-integer index %s", assignRight),
+			}
+		}
+		byteIndex := int(byteIndexVal)
+
+		if byteIndex < 0 || byteIndex > len(*target) {
+			return &RuntimeError{
+				reason: fmt.Sprintf("String assignment index %d out of range in %s", byteIndex, n),
+			}
+		}
+
+		if byteIndex == len(*target) {
+			// append
+			*target = append(*target, *assignedString...)
+		} else {
+			for byteOffset, byteAtOffset := range *assignedString {
+				if byteIndex+byteOffset < len(*target) {
+					(*target)[byteIndex+byteOffset] = byteAtOffset
+				} else {
+					*target = append(*target, byteAtOffset)
+				}
+			}
+		}
+	case *ListValue:
+		listIndexVal, ok := assignRight.(IntValue)
+		if !ok {
+			return &RuntimeError{
+				reason: fmt.Sprintf("Cannot index into list with non-integer index %s", assignRight),
+			}
+		}
+		listIndex := int(listIndexVal)
+
+		if listIndex < 0 || listIndex > len(*target) {
+			return &RuntimeError{
+				reason: fmt.Sprintf("List assignment index %d out of range in %s", listIndex, n),
+			}
+		}
+
+		if listIndex == len(*target) {
+			*target = append(*target, assignedValue)
+		} else {
+			(*target)[listIndex] = assignedValue
+		}
+	case ObjectValue:
+		objKeyString := objKeyString(assignRight)
+		if _, ok := assignedValue.(EmptyValue); ok {
+			delete(target, objKeyString)
+		} else {
+			target[objKeyString] = assignedValue
+		}
+	default:
+		return &RuntimeError{
+			reason: fmt.Sprintf("Expected string, list, or object in left-hand side of property assignment, got %s", n.(assignmentNode).left.String()),
+		}
+	}
+
+	return nil
+}
+
+func unaryOp(op tokKind, rightComputed Value) (Value, *RuntimeError) {
+	switch right := rightComputed.(type) {
+	case IntValue:
+		switch op {
+		case plus:
+			return right, nil
+		case minus:
+			return -right, nil
+		}
+	case FloatValue:
+		switch op {
+		case plus:
+			return right, nil
+		case minus:
+			return -right, nil
+		}
+	case BoolValue:
+		switch op {
+		case exclam:
+			return !right, nil
+		}
+	}
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("%s is not a valid unary operator for %s", token{kind: op}, rightComputed),
+	}
+}
+
+func binaryOp(op tokKind, leftComputed, rightComputed Value) (Value, *RuntimeError) {
+	if op == eq {
+		return BoolValue(leftComputed.Eq(rightComputed)), nil
+	} else if op == neq {
+		return BoolValue(!leftComputed.Eq(rightComputed)), nil
+	}
+
+	switch left := leftComputed.(type) {
+	case IntValue:
+		right, ok := rightComputed.(IntValue)
+		if !ok {
+			rightFloat, ok := rightComputed.(FloatValue)
+			if !ok {
+				return nil, incompatibleError(op, leftComputed, rightComputed)
+			}
+
+			leftFloat := FloatValue(float64(int64(left)))
+			return floatBinaryOp(op, leftFloat, rightFloat)
+		}
+
+		return intBinaryOp(op, left, right)
+	case FloatValue:
+		right, ok := rightComputed.(FloatValue)
+		if !ok {
+			rightInt, ok := rightComputed.(IntValue)
+			if !ok {
+				return nil, incompatibleError(op, leftComputed, rightComputed)
+			}
+
+			right = FloatValue(float64(int64(rightInt)))
+		}
+
+		return floatBinaryOp(op, left, right)
+	case *StringValue:
+		right, ok := rightComputed.(*StringValue)
+		if !ok {
+			return nil, incompatibleError(op, leftComputed, rightComputed)
+		}
+
+		switch op {
+		case plus:
+			base := make([]byte, 0, len(*left)+len(*right))
+			base = append(base, *left...)
+			base = append(base, *right...)
+			baseStr := StringValue(base)
+			return &baseStr, nil
+		case xor:
+			max := maxLen(*left, *right)
+
+			ls, rs := zeroExtend(*left, max), zeroExtend(*right, max)
+			res := make([]byte, max)
+			for i := range res {
+				res[i] = ls[i] ^ rs[i]
+			}
+			resStr := StringValue(res)
+			return &resStr, nil
+		case and:
+			max := maxLen(*left, *right)
+
+			ls, rs := zeroExtend(*left, max), zeroExtend(*right, max)
+			res := make([]byte, max)
+			for i := range res {
+				res[i] = ls[i] & rs[i]
+			}
+			resStr := StringValue(res)
+			return &resStr, nil
+		case or:
+			max := maxLen(*left, *right)
+
+			ls, rs := zeroExtend(*left, max), zeroExtend(*right, max)
+			res := make([]byte, max)
+			for i := range res {
+				res[i] = ls[i] | rs[i]
+			}
+			resStr := StringValue(res)
+			return &resStr, nil
+		case pushArrow:
+			*left = append(*left, *right...)
+			return left, nil
+		case greater:
+			return BoolValue(bytes.Compare(*left, *right) > 0), nil
+		case less:
+			return BoolValue(bytes.Compare(*left, *right) < 0), nil
+		case geq:
+			return BoolValue(bytes.Compare(*left, *right) >= 0), nil
+		case leq:
+			return BoolValue(bytes.Compare(*left, *right) <= 0), nil
+		}
+		return nil, incompatibleError(op, leftComputed, rightComputed)
+	case BoolValue:
+		right, ok := rightComputed.(BoolValue)
+		if !ok {
+			return nil, incompatibleError(op, leftComputed, rightComputed)
+		}
+
+		switch op {
+		case plus, or:
+			return BoolValue(left || right), nil
+		case times, and:
+			return BoolValue(left && right), nil
+		case xor:
+			return BoolValue(left != right), nil
+		}
+	case *ListValue:
+		switch op {
+		case pushArrow:
+			*left = append(*left, rightComputed)
+			return left, nil
+		}
+		return nil, incompatibleError(op, leftComputed, rightComputed)
+	}
+	return nil, &RuntimeError{
+		reason: fmt.Sprintf("Binary operator %s is not defined for values %s, %s",
+			token{kind: op}, leftComputed, rightComputed),
+	}
+}
@@ -0,0 +1,229 @@
+package oak
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+)
+
+// defaultWatchInterval is how often watch() checks for changes by default.
+const defaultWatchInterval = 500 * time.Millisecond
+
+// watchSnapshot is the state of every file a watch() call is watching, by
+// path, at one point in time.
+type watchSnapshot map[string]fs.FileInfo
+
+// snapshot returns the state of the file at root in fsys, and if it is a
+// directory, the files in it, and in its subdirectories if recursive is set.
+// Symbolic links to directories are not followed. Files that cannot be read
+// are left out of the snapshot, as if they did not exist.
+func snapshot(fsys FS, root string, recursive bool) watchSnapshot {
+	snap := watchSnapshot{}
+	info, err := fsys.Stat(root)
+	if err != nil {
+		return snap
+	}
+	if !info.IsDir() {
+		snap[root] = info
+		return snap
+	}
+
+	var add func(dir string)
+	add = func(dir string) {
+		entries, err := fsys.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			entryPath := path.Join(dir, entry.Name())
+			snap[entryPath] = info
+			if recursive && entry.IsDir() {
+				add(entryPath)
+			}
+		}
+	}
+	add(root)
+	return snap
+}
+
+// watchEvents returns events for the changes from one snapshot to the next,
+// in order by path. A file that disappears while another that is the same
+// file appears is reported as renamed.
+func watchEvents(prev, next watchSnapshot) []ObjectValue {
+	var created, deleted []string
+	for name := range next {
+		if _, ok := prev[name]; !ok {
+			created = append(created, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := next[name]; !ok {
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(deleted)
+
+	events := map[string]ObjectValue{}
+	renamedTo := map[string]bool{}
+	for _, from := range deleted {
+		event := ObjectValue{
+			"type": AtomValue("delete"),
+			"path": MakeString(from),
+		}
+		for _, to := range created {
+			if !renamedTo[to] && sameFile(prev[from], next[to]) {
+				renamedTo[to] = true
+				event = ObjectValue{
+					"type": AtomValue("rename"),
+					"from": MakeString(from),
+					"path": MakeString(to),
+				}
+				break
+			}
+		}
+		events[from] = event
+	}
+	for _, name := range created {
+		if !renamedTo[name] {
+			events[name] = ObjectValue{
+				"type": AtomValue("create"),
+				"path": MakeString(name),
+			}
+		}
+	}
+	for name, info := range next {
+		if prevInfo, ok := prev[name]; ok && !info.IsDir() &&
+			(info.Size() != prevInfo.Size() || !info.ModTime().Equal(prevInfo.ModTime()) || info.Mode() != prevInfo.Mode()) {
+			events[name] = ObjectValue{
+				"type": AtomValue("modify"),
+				"path": MakeString(name),
+			}
+		}
+	}
+
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sorted := make([]ObjectValue, len(names))
+	for i, name := range names {
+		sorted[i] = events[name]
+	}
+	return sorted
+}
+
+// oakWatch checks a file or directory for changes every so often, and calls
+// a callback with an event for each change until the returned handle is
+// cancelled. Like a ticker, an active watch keeps the program running.
+func (c *Context) oakWatch(args []Value) (Value, *RuntimeError) {
+	if len(args) == 2 {
+		args = []Value{args[0], null, args[1]}
+	}
+	if err := c.requireArgLen("watch", args, 3); err != nil {
+		return nil, err
+	}
+
+	watchPath, ok1 := args[0].(*StringValue)
+	options, ok2 := args[1].(ObjectValue)
+	if _, isNull := args[1].(NullValue); isNull {
+		options, ok2 = ObjectValue{}, true
+	}
+	callback, ok3 := args[2].(FnValue)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call watch(%s, %s, %s)", args[0], args[1], args[2]),
+		}
+	}
+
+	recursive := false
+	switch opt := options["recursive"].(type) {
+	case nil, NullValue:
+	case BoolValue:
+		recursive = bool(opt)
+	default:
+		return nil, &RuntimeError{
+			reason: fmt.Sprintf("Mismatched types in call watch, recursive must be a bool, got %s", opt),
+		}
+	}
+	interval := defaultWatchInterval
+	if opt, ok := options["interval"]; ok && opt != null {
+		d, err := waitDuration("watch", opt)
+		if err != nil {
+			return nil, err
+		}
+		if d <= 0 {
+			return nil, &RuntimeError{
+				reason: fmt.Sprintf("watch() requires a positive interval, got %s", opt),
+			}
+		}
+		interval = d
+	}
+
+	if denied := c.denyFS("watch", watchPath.stringContent(), false); denied != nil {
+		return denied, nil
+	}
+	root := watchPath.stringContent()
+	// the engine's filesystem is only accessed while holding the interpreter
+	// lock, so the watch keeps the one it started with
+	fsys := c.eng.fs
+	if _, err := fsys.Stat(root); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errObj(fmt.Sprintf("Could not watch %s: %s", root, err.Error())), nil
+	}
+
+	// active is only accessed while holding the interpreter lock
+	active := true
+	stop := make(chan struct{})
+	goCtx := c.eng.goContext()
+	prev := snapshot(fsys, root, recursive)
+	c.eng.Add(1)
+	go func() {
+		defer c.eng.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				next := snapshot(fsys, root, recursive)
+				events := watchEvents(prev, next)
+				prev = next
+
+				c.Lock()
+				for _, evt := range events {
+					if !active || goCtx.Err() != nil {
+						break
+					}
+					if _, err := c.EvalFnValue(callback, evt); err != nil && c.eng.canceled() == nil {
+						c.eng.asyncError(err)
+					}
+				}
+				c.Unlock()
+			case <-stop:
+				return
+			case <-goCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return ObjectValue{
+		"type": AtomValue("watch"),
+		"cancel": MakeBuiltinFn("cancel", func(_ []Value) (Value, *RuntimeError) {
+			if !active {
+				return oakFalse, nil
+			}
+			active = false
+			close(stop)
+			return oakTrue, nil
+		}),
+	}, nil
+}